@@ -1,6 +1,8 @@
 package ast
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"strings"
 
@@ -9,12 +11,28 @@ import (
 	"github.com/tekwizely/run/internal/runfile"
 )
 
-// ProcessAST processes an AST into a Runfile.
+// ProcessAST processes one or more ASTs, in order, into a single Runfile.
 //
-func ProcessAST(ast *Ast) *runfile.Runfile {
+func ProcessAST(app *config.App, asts ...*Ast) *runfile.Runfile {
 	rf := runfile.NewRunfile()
-	for _, n := range ast.nodes {
-		n.Apply(rf)
+	// Profiles and .CLI_VARS first, so that they apply to assignments before, as well as after, them
+	//
+	for _, ast := range asts {
+		for _, n := range ast.nodes {
+			switch n := n.(type) {
+			case *Profile:
+				n.collect(app, rf)
+			case *nodeScopeNode:
+				if attr, ok := n.node.(*ScopeAttrAssignment); ok && attr.Name == runfile.CLIVarsAttr {
+					attr.Apply(app, rf.Scope)
+				}
+			}
+		}
+	}
+	for _, ast := range asts {
+		for _, n := range ast.nodes {
+			n.Apply(app, rf)
+		}
 	}
 	return rf
 }
@@ -37,6 +55,18 @@ func (a *Ast) AddScopeNode(n scopeNode) {
 	a.nodes = append(a.nodes, &nodeScopeNode{node: n})
 }
 
+// CmdNames returns the names of the commands defined in the ast.
+//
+func (a *Ast) CmdNames() []string {
+	var names []string
+	for _, n := range a.nodes {
+		if cmd, ok := n.(*Cmd); ok {
+			names = append(names, cmd.Name)
+		}
+	}
+	return names
+}
+
 // NewAST is a convenience method.
 //
 func NewAST() *Ast {
@@ -47,19 +77,19 @@ func NewAST() *Ast {
 // node
 //
 type node interface {
-	Apply(r *runfile.Runfile)
+	Apply(app *config.App, r *runfile.Runfile)
 }
 
 // scopeNode
 //
 type scopeNode interface {
-	Apply(s *runfile.Scope)
+	Apply(app *config.App, s *runfile.Scope)
 }
 
 // ScopeValueNode is a scope node that results in a string value.
 //
 type ScopeValueNode interface {
-	Apply(s *runfile.Scope) string
+	Apply(app *config.App, s *runfile.Scope) string
 }
 
 // nodeScopeNode
@@ -70,8 +100,8 @@ type nodeScopeNode struct {
 
 // Apply applies the node to the runfile.
 //
-func (a *nodeScopeNode) Apply(r *runfile.Runfile) {
-	a.node.Apply(r.Scope)
+func (a *nodeScopeNode) Apply(app *config.App, r *runfile.Runfile) {
+	a.node.Apply(app, r.Scope)
 }
 
 // ScopeValueNodeList builds a single string from a list of value nodes.
@@ -82,11 +112,11 @@ type ScopeValueNodeList struct {
 
 // Apply applies the node to the scope.
 //
-func (a *ScopeValueNodeList) Apply(s *runfile.Scope) string {
+func (a *ScopeValueNodeList) Apply(app *config.App, s *runfile.Scope) string {
 	b := &strings.Builder{}
 	if a != nil {
 		for _, v := range a.Values {
-			b.WriteString(v.Apply(s))
+			b.WriteString(v.Apply(app, s))
 		}
 	}
 	return b.String()
@@ -118,12 +148,54 @@ func NewScopeExportList1(name string) *ScopeExportList {
 
 // Apply applies the node to the scope.
 //
-func (a *ScopeExportList) Apply(s *runfile.Scope) {
+func (a *ScopeExportList) Apply(_ *config.App, s *runfile.Scope) {
 	for _, name := range a.Names {
 		s.AddExport(name)
 	}
 }
 
+// Profile wraps a PROFILE block.
+//
+type Profile struct {
+	Name string
+	Ast  *Ast
+}
+
+// collect registers the profile and, if it is active, its assignments,
+// which are then applied in place of any other assignment to the same names, wherever it is in the runfiles.
+// Later blocks for the same profile take precedence.
+//
+func (a *Profile) collect(app *config.App, r *runfile.Runfile) {
+	r.AddProfile(a.Name)
+	if !strings.EqualFold(app.Profile, a.Name) {
+		return
+	}
+	for _, n := range a.Ast.nodes {
+		if n, ok := n.(*nodeScopeNode); ok {
+			switch n := n.node.(type) {
+			case *ScopeVarAssignment:
+				r.Scope.ProfileVars[n.Name] = n
+			case *ScopeVarQAssignment:
+				r.Scope.ProfileVars[n.Name] = n
+			case *ScopeAttrAssignment:
+				r.Scope.ProfileAttrs[n.Name] = n
+			}
+		}
+	}
+}
+
+// Apply applies the node to the runfile.
+// The assignments are only applied if the profile is active, defining any variables not assigned elsewhere.
+//
+func (a *Profile) Apply(app *config.App, r *runfile.Runfile) {
+	if !strings.EqualFold(app.Profile, a.Name) {
+		return
+	}
+	for _, n := range a.Ast.nodes {
+		n.Apply(app, r)
+	}
+}
+
 // Cmd wraps a parsed command.
 //
 type Cmd struct {
@@ -134,12 +206,22 @@ type Cmd struct {
 
 // Apply applies the node to the runfile.
 //
-func (a *Cmd) Apply(r *runfile.Runfile) {
+func (a *Cmd) Apply(app *config.App, r *runfile.Runfile) {
 	cmd := &runfile.RunCmd{
 		Name:   a.Name,
 		Scope:  runfile.NewScope(),
 		Script: a.Script,
 	}
+	// Executors
+	//
+	for _, e := range r.Scope.Executors {
+		cmd.Scope.PutExecutor(e)
+	}
+	// Profile overrides
+	//
+	for key, value := range r.Scope.ProfileVars {
+		cmd.Scope.ProfileVars[key] = value
+	}
 	// Exports
 	//
 	for _, name := range r.Scope.GetExports() {
@@ -159,13 +241,17 @@ func (a *Cmd) Apply(r *runfile.Runfile) {
 	// Config Environment
 	//
 	for _, varAssignment := range a.Config.Vars {
-		varAssignment.Apply(cmd.Scope)
+		varAssignment.Apply(app, cmd.Scope)
 	}
 	// Attrs
 	//
 	for k, v := range r.Scope.Attrs {
 		cmd.Scope.PutAttr(k, v)
 	}
+	// Command-line variables
+	// Re-applied over the command's own assignments, which are applied before the attrs that enable them
+	//
+	runfile.ApplyCLIVars(app, cmd.Scope)
 	// Config
 	//
 	cmd.Config = &runfile.RunCmdConfig{}
@@ -173,21 +259,111 @@ func (a *Cmd) Apply(r *runfile.Runfile) {
 	//
 	cmd.Config.Shell = a.Config.Shell
 	cmd.Scope.PutAttr(".SHELL", cmd.Shell())
+	// .SHELLFLAGS
+	// Flags declared with SHELL replace the global flags, which only apply to the global shell
+	//
+	var shellFlags string
+	if len(a.Config.Shell) > 0 {
+		if a.Config.ShellFlags != nil {
+			shellFlags = strings.TrimSpace(a.Config.ShellFlags.Apply(app, cmd.Scope))
+		}
+	} else {
+		shellFlags, _ = cmd.Scope.GetAttr(".SHELLFLAGS")
+	}
+	var err error
+	if cmd.Config.ShellFlags, err = exec.SplitWords(shellFlags); err != nil {
+		panic(fmt.Sprintf("%s: SHELL: %v", cmd.Name, err))
+	}
+	cmd.Scope.PutAttr(".SHELLFLAGS", shellFlags)
 	// Config Desc
 	//
 	for _, desc := range a.Config.Desc {
-		cmd.Config.Desc = append(cmd.Config.Desc, desc.Apply(cmd.Scope))
+		cmd.Config.Desc = append(cmd.Config.Desc, desc.Apply(app, cmd.Scope))
 	}
 	cmd.Config.Desc = runfile.NormalizeCmdDesc(cmd.Config.Desc)
 	// Config Usages
 	//
 	for _, usage := range a.Config.Usages {
-		cmd.Config.Usages = append(cmd.Config.Usages, usage.Apply(cmd.Scope))
+		cmd.Config.Usages = append(cmd.Config.Usages, usage.Apply(app, cmd.Scope))
 	}
 	// Config Opts
 	//
 	for _, opt := range a.Config.Opts {
-		cmd.Config.Opts = append(cmd.Config.Opts, opt.Apply(cmd))
+		cmd.Config.Opts = append(cmd.Config.Opts, opt.Apply(app, cmd))
+	}
+	// Config Watches
+	//
+	for _, watch := range a.Config.Watches {
+		cmd.Config.Watch = append(cmd.Config.Watch, strings.Fields(watch.Apply(app, cmd.Scope))...)
+	}
+	// Config Sources / Outputs
+	//
+	for _, source := range a.Config.Sources {
+		cmd.Config.Sources = append(cmd.Config.Sources, strings.Fields(source.Apply(app, cmd.Scope))...)
+	}
+	for _, output := range a.Config.Outputs {
+		cmd.Config.Outputs = append(cmd.Config.Outputs, strings.Fields(output.Apply(app, cmd.Scope))...)
+	}
+	// Config Hooks
+	// Resolved to commands once the runfile is complete
+	//
+	for _, before := range a.Config.Before {
+		cmd.Config.Before = append(cmd.Config.Before, strings.Fields(before.Apply(app, cmd.Scope))...)
+	}
+	for _, after := range a.Config.After {
+		cmd.Config.After = append(cmd.Config.After, strings.Fields(after.Apply(app, cmd.Scope))...)
+	}
+	for _, finally := range a.Config.Finally {
+		cmd.Config.Finally = append(cmd.Config.Finally, strings.Fields(finally.Apply(app, cmd.Scope))...)
+	}
+	// Config Timeout
+	// Defaults to the global .TIMEOUT
+	//
+	if a.Config.Timeout != nil {
+		value := a.Config.Timeout.Apply(app, cmd.Scope)
+		if cmd.Config.Timeout, err = runfile.ParseTimeout(value); err != nil {
+			panic(fmt.Sprintf("%s: TIMEOUT: %v", cmd.Name, err))
+		}
+	} else if value, ok := cmd.Scope.GetAttr(".TIMEOUT"); ok {
+		if cmd.Config.Timeout, err = runfile.ParseTimeout(value); err != nil {
+			panic(fmt.Sprintf("%s: .TIMEOUT: %v", cmd.Name, err))
+		}
+	}
+	// Config Retry
+	//
+	if a.Config.Retry != nil {
+		value := a.Config.Retry.Apply(app, cmd.Scope)
+		if cmd.Config.Retry, err = runfile.ParseRetry(value); err != nil {
+			panic(fmt.Sprintf("%s: RETRY: %v", cmd.Name, err))
+		}
+	}
+	// Config Confirm
+	//
+	if a.Config.Confirm != nil {
+		cmd.Config.Confirm = runfile.TrimQuotes(strings.TrimSpace(a.Config.Confirm.Apply(app, cmd.Scope)))
+	}
+	// Config Cache
+	// Only '#!' scripts are run from the script cache
+	//
+	if a.Config.Cache != nil {
+		if cmd.Config.Cache, err = runfile.ParseCache(a.Config.Cache.Apply(app, cmd.Scope)); err != nil {
+			panic(fmt.Sprintf("%s: CACHE: %v", cmd.Name, err))
+		}
+		if cmd.Config.Cache && cmd.Shell() != "#!" {
+			panic(fmt.Sprintf("%s: CACHE: only supported by '#!' commands (shell is '%s')", cmd.Name, cmd.Shell()))
+		}
+	}
+	// Config Script Mode
+	//
+	if value, ok := cmd.Scope.GetAttr(".SCRIPT_MODE"); ok {
+		if cmd.Config.ScriptMode, err = exec.ParseScriptMode(value); err != nil {
+			panic(fmt.Sprintf("%s: .SCRIPT_MODE: %v", cmd.Name, err))
+		}
+	}
+	// Config Completes
+	//
+	for _, complete := range a.Config.Completes {
+		cmd.Config.Completes = append(cmd.Config.Completes, complete.Apply(app, cmd))
 	}
 	r.Cmds = append(r.Cmds, cmd)
 }
@@ -195,12 +371,24 @@ func (a *Cmd) Apply(r *runfile.Runfile) {
 // CmdConfig wraps a command config.
 //
 type CmdConfig struct {
-	Shell   string
-	Desc    []ScopeValueNode
-	Usages  []ScopeValueNode
-	Opts    []*CmdOpt
-	Vars    []scopeNode
-	Exports []*ScopeExportList
+	Shell      string
+	ShellFlags ScopeValueNode
+	Desc       []ScopeValueNode
+	Usages     []ScopeValueNode
+	Opts       []*CmdOpt
+	Completes  []*CmdComplete
+	Watches    []ScopeValueNode
+	Sources    []ScopeValueNode
+	Outputs    []ScopeValueNode
+	Timeout    ScopeValueNode
+	Retry      ScopeValueNode
+	Confirm    ScopeValueNode
+	Before     []ScopeValueNode
+	After      []ScopeValueNode
+	Finally    []ScopeValueNode
+	Cache      ScopeValueNode
+	Vars       []scopeNode
+	Exports    []*ScopeExportList
 }
 
 // CmdOpt wraps a command option.
@@ -215,16 +403,32 @@ type CmdOpt struct {
 
 // Apply applies the node to the command.
 //
-func (a *CmdOpt) Apply(c *runfile.RunCmd) *runfile.RunCmdOpt {
+func (a *CmdOpt) Apply(app *config.App, c *runfile.RunCmd) *runfile.RunCmdOpt {
 	opt := &runfile.RunCmdOpt{}
 	opt.Name = a.Name
 	opt.Short = a.Short
 	opt.Long = a.Long
 	opt.Value = a.Value
-	opt.Desc = a.Desc.Apply(c.Scope)
+	opt.Desc = a.Desc.Apply(app, c.Scope)
 	return opt
 }
 
+// CmdComplete wraps a command completion provider.
+//
+type CmdComplete struct {
+	Target string
+	Script ScopeValueNode
+}
+
+// Apply applies the node to the command.
+//
+func (a *CmdComplete) Apply(app *config.App, c *runfile.RunCmd) *runfile.RunCmdComplete {
+	complete := &runfile.RunCmdComplete{}
+	complete.Target = a.Target
+	complete.Script = runfile.NormalizeCompleteScript(a.Script.Apply(app, c.Scope))
+	return complete
+}
+
 // ScopeAttrAssignment wraps an attribute assignment.
 //
 type ScopeAttrAssignment struct {
@@ -233,9 +437,32 @@ type ScopeAttrAssignment struct {
 }
 
 // Apply applies the node to the scope.
+// The active profile's assignment to the attr is applied in its place.
 //
-func (a *ScopeAttrAssignment) Apply(s *runfile.Scope) {
-	s.PutAttr(a.Name, a.Value.Apply(s))
+func (a *ScopeAttrAssignment) Apply(app *config.App, s *runfile.Scope) {
+	if override, ok := s.GetProfileAttr(a.Name); ok && override != runfile.Assignment(a) {
+		override.Apply(app, s)
+		return
+	}
+	s.PutAttr(a.Name, a.Value.Apply(app, s))
+}
+
+// ScopeExecutor wraps an executor declaration.
+//
+type ScopeExecutor struct {
+	Name  string
+	Value ScopeValueNode
+}
+
+// Apply applies the node to the scope.
+// Settings are applied on top of any previous declaration, or the registry.
+//
+func (a *ScopeExecutor) Apply(app *config.App, s *runfile.Scope) {
+	executor, err := exec.ParseExecutor(a.Name, a.Value.Apply(app, s), s.GetExecutor(a.Name))
+	if err != nil {
+		panic(fmt.Sprintf(".EXECUTOR %s: %v", a.Name, err))
+	}
+	s.PutExecutor(executor)
 }
 
 // ScopeVarAssignment wraps a variable assignment.
@@ -246,9 +473,19 @@ type ScopeVarAssignment struct {
 }
 
 // Apply applies the node to the scope.
+// Variables given on the command line take precedence, without evaluating the assignment,
+// and the active profile's assignment to the variable is applied in its place.
 //
-func (a *ScopeVarAssignment) Apply(s *runfile.Scope) {
-	s.PutVar(a.Name, a.Value.Apply(s))
+func (a *ScopeVarAssignment) Apply(app *config.App, s *runfile.Scope) {
+	if value, ok := runfile.CLIVar(app, s, a.Name); ok {
+		s.PutVar(a.Name, value)
+		return
+	}
+	if override, ok := s.GetProfileVar(a.Name); ok && override != runfile.Assignment(a) {
+		override.Apply(app, s)
+		return
+	}
+	s.PutVar(a.Name, a.Value.Apply(app, s))
 }
 
 // ScopeVarQAssignment wraps a variable Q-Assignment.
@@ -259,15 +496,25 @@ type ScopeVarQAssignment struct {
 }
 
 // Apply applies the node to the scope.
+// Variables given on the command line take precedence, without evaluating the assignment,
+// and the active profile's assignment to the variable is applied in its place.
 //
-func (a *ScopeVarQAssignment) Apply(s *runfile.Scope) {
+func (a *ScopeVarQAssignment) Apply(app *config.App, s *runfile.Scope) {
+	if value, ok := runfile.CLIVar(app, s, a.Name); ok {
+		s.PutVar(a.Name, value)
+		return
+	}
+	if override, ok := s.GetProfileVar(a.Name); ok && override != runfile.Assignment(a) {
+		override.Apply(app, s)
+		return
+	}
 	// Only assign if not already present+non-empty
 	//
 	if val, ok := s.GetVar(a.Name); !ok || len(val) == 0 {
 		// Use the Env value, if present+non-empty, else the assignment value
 		//
 		if val, ok = s.GetEnv(a.Name); !ok || len(val) == 0 {
-			val = a.Value.Apply(s)
+			val = a.Value.Apply(app, s)
 		}
 		s.PutVar(a.Name, val)
 	}
@@ -281,7 +528,7 @@ type ScopeValueRunes struct {
 
 // Apply applies the node to the scope, returning the value.
 //
-func (a *ScopeValueRunes) Apply(_ *runfile.Scope) string {
+func (a *ScopeValueRunes) Apply(_ *config.App, _ *runfile.Scope) string {
 	return a.Value
 }
 
@@ -293,7 +540,7 @@ type ScopeValueEsc struct {
 
 // Apply applies the node to the scope, returning the value.
 //
-func (a *ScopeValueEsc) Apply(_ *runfile.Scope) string {
+func (a *ScopeValueEsc) Apply(_ *config.App, _ *runfile.Scope) string {
 	return string([]rune(a.Seq)[1]) // TODO A bit of a hack
 }
 
@@ -305,7 +552,7 @@ type ScopeValueVar struct {
 
 // Apply applies the node to the scope, returning the value.
 //
-func (a *ScopeValueVar) Apply(s *runfile.Scope) string {
+func (a *ScopeValueVar) Apply(_ *config.App, s *runfile.Scope) string {
 	if val, ok := s.GetVar(a.Name); ok {
 		return val
 	}
@@ -326,8 +573,8 @@ type ScopeValueShell struct {
 
 // Apply applies the node to the scope, returning the value.
 //
-func (a *ScopeValueShell) Apply(s *runfile.Scope) string {
-	cmd := a.Cmd.Apply(s)
+func (a *ScopeValueShell) Apply(app *config.App, s *runfile.Scope) string {
+	cmd := a.Cmd.Apply(app, s)
 	env := make(map[string]string)
 	for _, name := range s.GetExports() {
 		if value, ok := s.GetVar(name); ok {
@@ -341,7 +588,19 @@ func (a *ScopeValueShell) Apply(s *runfile.Scope) string {
 	if !ok || len(shell) == 0 {
 		shell = config.DefaultShell
 	}
-	exec.ExecuteSubCommand(shell, cmd, env, capturedOutput)
+	mode, _ := s.GetAttr(".SCRIPT_MODE")
+	mode, err := exec.ParseScriptMode(mode)
+	if err != nil {
+		panic(fmt.Sprintf(".SCRIPT_MODE: %v", err))
+	}
+	flags, _ := s.GetAttr(".SHELLFLAGS")
+	shellFlags, err := exec.SplitWords(flags)
+	if err != nil {
+		panic(fmt.Sprintf(".SHELLFLAGS: %v", err))
+	}
+	// Substitutions are evaluated while the runfile is processed, before any command runs
+	//
+	exec.ExecuteSubCommand(context.Background(), app, shell, mode, s.GetExecutor(shell).WithFlags(shellFlags), cmd, env, capturedOutput)
 	result := capturedOutput.String()
 
 	// Trim trailing newlines, per std command-substitution behavior
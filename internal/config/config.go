@@ -1,66 +1,155 @@
 package config
 
 import (
+	"context"
 	"errors"
 	"io"
 	"log"
+	"os"
 	"reflect"
 	"runtime"
+	"strings"
+	"time"
 )
 
 // Command is an abstraction for a command, allowing us to mix runfile commands and custom comments (help, list, etc).
 //
 type Command struct {
-	Name   string
-	Title  string
-	Help   func()
-	Run    func()
-	Rename func(string) // Rename Command to script Name in 'main' mode
+	Name    string
+	Title   string
+	Builtin bool
+	Global  bool
+	Help    func()
+	Run     func(ctx context.Context, args []string, std *Stdio) int // Returns exit code
+	Check   func(args []string)                                      // Validates the arguments, exiting on error (optional)
+	Rename  func(string)                                             // Rename Command to script Name in 'main' mode
+}
+
+// Stdio captures the standard streams a command runs with.
+//
+type Stdio struct {
+	In  io.Reader
+	Out io.Writer
+	Err io.Writer
+}
+
+// OSStdio returns the process' standard streams.
+//
+func OSStdio() *Stdio {
+	return &Stdio{In: os.Stdin, Out: os.Stdout, Err: os.Stderr}
 }
 
 // DefaultShell specifies which shell to use for command scripts and sub-shells if none explicitly defined.
 //
 const DefaultShell = "sh"
 
-// Me stores the script name we consider the runfile to be running as.
+// CompleteTimeout limits how long a COMPLETE provider may run.
 //
-var Me string
+const CompleteTimeout = 2 * time.Second
 
-// ErrOut is where logs and errors are sent to (generally stderr).
+// DefaultKillGrace is how long a terminated script is given to exit before it is killed, if not otherwise configured.
 //
-var ErrOut io.Writer
+const DefaultKillGrace = 5 * time.Second
 
 // ErrShell is an Error message for missing .SHELL attribute
 //
 var ErrShell = errors.New(".SHELL not defined")
 
-// CommandList stores a list of commands.
-//
-var CommandList []*Command
-
-// CommandMap stores a map of commands, keyed by the command name (lowercased)
+// DryRun formats
 //
-var CommandMap = make(map[string]*Command)
+const (
+	DryRunText = "text"
+	DryRunJSON = "json"
+)
 
-// EnableFnTrace shows parser/lexer fn call/stack
+// App holds the state of a run invocation: its commands, where messages go, and the options in effect.
+// It is passed explicitly, so that several runfiles can be loaded within one process.
 //
-var EnableFnTrace = false
+type App struct {
+	// Me stores the script name we consider the runfile to be running as.
+	//
+	Me string
+	// ErrOut is where logs and errors are sent to (generally stderr).
+	//
+	ErrOut io.Writer
+	// CommandList stores a list of commands.
+	//
+	CommandList []*Command
+	// CommandMap stores a map of commands, keyed by the command name (lowercased)
+	//
+	CommandMap map[string]*Command
+	// EnableFnTrace shows parser/lexer fn call/stack
+	//
+	EnableFnTrace bool
+	// ShowScriptFiles shows Command/sub-shell filenames
+	//
+	ShowScriptFiles bool
+	// ShowCmdShells shows the command shell in the command's help screen
+	//
+	ShowCmdShells bool
+	// DryRun, if set, prints the resolved command instead of executing it.
+	// Either DryRunText or DryRunJSON.
+	//
+	DryRun string
+	// ShowSecrets disables masking of secret-looking variables in dry-run output.
+	//
+	ShowSecrets bool
+	// UseChecksums compares SOURCES by content hash, rather than modification time, when deciding if a command is up to date.
+	//
+	UseChecksums bool
+	// ForceRun runs commands even if their OUTPUTS are up to date.
+	//
+	ForceRun bool
+	// EnableRunfileOverride indicates if '-r | --runfile' arguments are supported in the current mode.
+	//
+	EnableRunfileOverride bool
+	// KillGrace is how long a terminated script is given to exit before it is killed.
+	//
+	KillGrace time.Duration
+	// AssumeYes skips CONFIRM prompts, answering 'yes'.
+	//
+	AssumeYes bool
+	// Timeout overrides the TIMEOUT of every command, if set (0 = no timeout).
+	//
+	Timeout *time.Duration
+	// CLIVars holds variables given on the command line ('--set NAME=value', or trailing 'NAME=value' arguments).
+	// They override assignments in runfiles that enable them with .CLI_VARS.
+	//
+	CLIVars map[string]string
+	// Profile names the active profile ('--profile' or RUN_PROFILE), whose PROFILE blocks override runfile assignments.
+	//
+	Profile string
+	// Profiles lists the profiles declared by the runfiles.
+	//
+	Profiles []string
+}
 
-// ShowScriptFiles shows Command/sub-shell filenames
+// NewApp is a convenience method.
 //
-var ShowScriptFiles = false
-
-// ShowCmdShells shows the command shell in the command's help screen
-var ShowCmdShells = false
+func NewApp(me string, errOut io.Writer) *App {
+	return &App{
+		Me:                    me,
+		ErrOut:                errOut,
+		CommandMap:            make(map[string]*Command),
+		EnableRunfileOverride: true,
+		KillGrace:             DefaultKillGrace,
+	}
+}
 
-// EnableRunfileOverride indicates if '-r | --runfile' arguments are supported in the current mode.
+// AddCommand registers the command under its (lowercased) name.
+// Listed commands are also added to CommandList.
 //
-var EnableRunfileOverride = true
+func (a *App) AddCommand(cmd *Command, listed bool) {
+	a.CommandMap[strings.ToLower(cmd.Name)] = cmd
+	if listed {
+		a.CommandList = append(a.CommandList, cmd)
+	}
+}
 
 // TraceFn logs lexer transitions
 //
-func TraceFn(msg string, i interface{}) {
-	if EnableFnTrace {
+func (a *App) TraceFn(msg string, i interface{}) {
+	if a.EnableFnTrace {
 		fnName := runtime.FuncForPC(reflect.ValueOf(i).Pointer()).Name()
 		log.Println(msg, ":", fnName)
 	}
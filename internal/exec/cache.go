@@ -0,0 +1,229 @@
+package exec
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Script cache environment variables
+//
+const (
+	CacheDirEnv     = "RUN_CACHE_DIR"      // Overrides the script cache directory
+	CacheMaxSizeEnv = "RUN_CACHE_MAX_SIZE" // Maximum total size of the script cache, i.e. '500M'
+	CacheEntryVar   = "RUN_CACHE_ENTRY"    // Exported to cached scripts: the directory holding the script, for artifacts
+)
+
+// DefaultCacheMaxSize limits the total size of the script cache, unless overridden by CacheMaxSizeEnv.
+//
+const DefaultCacheMaxSize int64 = 256 << 20
+
+// cacheScriptName is the name of the script file within a cache entry, before the executor's extension.
+//
+const cacheScriptName = "script"
+
+// cacheKeyLen is the length of cache entry keys (and directory names), in hex digits.
+//
+const cacheKeyLen = 32
+
+// CacheEntry describes an entry in the script cache.
+//
+type CacheEntry struct {
+	Key  string    // Hash of the interpreter and script text
+	Dir  string    // Entry directory, holding the script and any artifacts
+	Size int64     // Total size of the entry's files
+	Used time.Time // When the entry was last used
+}
+
+// ScriptCacheDir returns the script cache directory: CacheDirEnv, or 'run/scripts' within the user's cache directory.
+//
+func ScriptCacheDir() (string, error) {
+	if dir := os.Getenv(CacheDirEnv); len(dir) > 0 {
+		return dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "run", "scripts"), nil
+}
+
+// ScriptCacheMaxSize returns the maximum total size of the script cache, from CacheMaxSizeEnv (0 = no limit).
+//
+func ScriptCacheMaxSize() (int64, error) {
+	value := os.Getenv(CacheMaxSizeEnv)
+	if len(value) == 0 {
+		return DefaultCacheMaxSize, nil
+	}
+	size, err := ParseSize(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", CacheMaxSizeEnv, err)
+	}
+	return size, nil
+}
+
+// ParseSize parses a size in bytes, with an optional K, M or G suffix (powers of 1024), i.e. '500M'.
+//
+func ParseSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	s = strings.TrimSuffix(s, "B")
+	multiplier := int64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			s = s[:n-1]
+		}
+	}
+	size, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size '%s': expecting a number of bytes, i.e. '1024', '500K', '100M' or '1G'", value)
+	}
+	return size * multiplier, nil
+}
+
+// CachedScriptPath returns the entry directory and script file for the script, within the script cache.
+// The entry is keyed by the hash of the interpreter (shell) and the script text.
+//
+func CachedScriptPath(e *Executor, text string) (string, string, error) {
+	dir, err := ScriptCacheDir()
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(e.Name + "\x00" + text))
+	entry := filepath.Join(dir, hex.EncodeToString(sum[:cacheKeyLen/2]))
+	return entry, filepath.Join(entry, cacheScriptName+e.Ext), nil
+}
+
+// cachedScriptFile fetches the script file from the script cache, writing it if not already cached.
+// Returns the entry directory and script file, and whether the entry was created.
+//
+func cachedScriptFile(e *Executor, text string) (string, string, bool, error) {
+	entry, file, err := CachedScriptPath(e, text)
+	if err != nil {
+		return "", "", false, err
+	}
+	if _, err = os.Stat(file); err == nil {
+		// Mark as recently used
+		//
+		now := time.Now()
+		_ = os.Chtimes(entry, now, now)
+		return entry, file, false, nil
+	}
+	if err = os.MkdirAll(entry, 0700); err != nil {
+		return "", "", false, err
+	}
+	// Write to a temp file, then rename, so that a partial script is never seen by a concurrent run
+	//
+	tmp, err := writeScriptFile(e, entry, "."+cacheScriptName+"-*", text)
+	if err != nil {
+		return "", "", false, err
+	}
+	if err = os.Rename(tmp, file); err != nil {
+		_ = os.Remove(tmp)
+		return "", "", false, err
+	}
+	return entry, file, true, nil
+}
+
+// ScriptCacheEntries lists the entries of the script cache, most recently used first.
+// Only directories that look like cache entries are listed, so that nothing else in the cache directory is ever removed.
+//
+func ScriptCacheEntries() ([]*CacheEntry, error) {
+	dir, err := ScriptCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var entries []*CacheEntry
+	for _, info := range infos {
+		if !info.IsDir() || !isCacheEntry(filepath.Join(dir, info.Name())) {
+			continue
+		}
+		entry := &CacheEntry{Key: info.Name(), Dir: filepath.Join(dir, info.Name()), Used: info.ModTime()}
+		_ = filepath.Walk(entry.Dir, func(_ string, info os.FileInfo, err error) error {
+			if err == nil && info.Mode().IsRegular() {
+				entry.Size += info.Size()
+			}
+			return nil
+		})
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Used.After(entries[j].Used) })
+	return entries, nil
+}
+
+// isCacheEntry returns true if the directory is named like a cache entry key, and holds a cached script.
+//
+func isCacheEntry(dir string) bool {
+	key := filepath.Base(dir)
+	if len(key) != cacheKeyLen {
+		return false
+	}
+	if _, err := hex.DecodeString(key); err != nil {
+		return false
+	}
+	scripts, err := filepath.Glob(filepath.Join(dir, cacheScriptName+"*"))
+	return err == nil && len(scripts) > 0
+}
+
+// CleanScriptCache removes every entry of the script cache, returning how many were removed.
+//
+func CleanScriptCache() (int, error) {
+	entries, err := ScriptCacheEntries()
+	if err != nil {
+		return 0, err
+	}
+	for i, entry := range entries {
+		if err = os.RemoveAll(entry.Dir); err != nil {
+			return i, err
+		}
+	}
+	return len(entries), nil
+}
+
+// PruneScriptCache removes the least recently used entries of the script cache, until its total size is within maxSize.
+// The entry directory given by keep is never removed.
+//
+func PruneScriptCache(maxSize int64, keep string) error {
+	if maxSize <= 0 {
+		return nil
+	}
+	entries, err := ScriptCacheEntries()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, entry := range entries {
+		total += entry.Size
+	}
+	for i := len(entries) - 1; i >= 0 && total > maxSize; i-- {
+		if entries[i].Dir == keep {
+			continue
+		}
+		if err = os.RemoveAll(entries[i].Dir); err != nil {
+			return err
+		}
+		total -= entries[i].Size
+	}
+	return nil
+}
@@ -1,99 +1,337 @@
 package exec
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/tekwizely/run/internal/config"
 )
 
-var tempDir string
+// errorCode is returned when a script cannot be executed.
+//
+const errorCode = 126
+
+// TimeoutCode is returned when a script is terminated for running longer than its timeout.
+//
+const TimeoutCode = 124
+
+// ErrTimeout is returned (wrapped) when a script is terminated for running longer than its timeout.
+//
+var ErrTimeout = errors.New("timed out")
+
+// ForwardedSignals are the signals forwarded to a running script, when requested.
+//
+var ForwardedSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP}
+
+// Options configures the process a script runs in.
+// Scripts always run in their own process group, which is terminated as a whole.
+//
+type Options struct {
+	Name           string        // Command name, used in messages
+	Environ        []string      // Base environment; nil = os.Environ()
+	Dir            string        // Working directory; "" = current directory
+	Foreground     bool          // Hand the terminal to the script while it runs, if stdin is the terminal
+	ForwardSignals bool          // Forward ForwardedSignals received by run to the script
+	KillGrace      time.Duration // How long to wait after terminating the script before killing it; 0 = config.DefaultKillGrace
+	Timeout        time.Duration // Terminate the script if it runs longer; 0 = no timeout
+	Retry          *RetryPolicy  // Re-run the script if it fails; nil = no retries
+	ScriptMode     string        // How the script is delivered to the shell; "" = DefaultScriptMode
+	Executor       *Executor     // How the shell runs the script; nil = LookupExecutor
+	Cache          bool          // Keep '#!' scripts in the script cache, rather than a temp file
+}
 
-func executeScript(shell string, script []string, args []string, env map[string]string, prefix string, out io.Writer) {
+// executeScript executes a script, returning its exit code.
+// If ctx is cancelled, the script's process group is terminated.
+// If the script cannot be executed, returns errorCode along with the error.
+// If the script times out, returns TimeoutCode along with ErrTimeout.
+//
+func executeScript(ctx context.Context, app *config.App, shell string, script []string, args []string, env map[string]string, prefix string, std *config.Stdio, opts Options) (int, error) {
 	if shell == "" {
-		panic(config.ErrShell)
+		return errorCode, config.ErrShell
+	}
+	parent := ctx
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
 	}
 	if len(script) == 0 {
-		return
+		return 0, nil
 	}
-	tmpFile, err := tempFile(fmt.Sprintf("%s-%s-*.sh", prefix, shell))
-	if err != nil {
-		log.Fatal(err)
+	name := opts.Name
+	if len(name) == 0 {
+		name = prefix
 	}
-	defer tmpFile.Close()
-	if config.ShowScriptFiles {
-		fmt.Fprintln(config.ErrOut, tmpFile.Name())
-	} else {
-		defer os.Remove(tmpFile.Name()) // clean up
+	executor := opts.Executor
+	if executor == nil {
+		executor = LookupExecutor(shell)
 	}
-
-	for _, line := range script {
-		if _, err = tmpFile.Write([]byte(line)); err != nil {
-			log.Fatal(err)
+	var (
+		mode    = ResolveScriptMode(executor, opts.ScriptMode, script)
+		text    = strings.Join(script, "")
+		pattern = fmt.Sprintf("runfile-%s-%s-*%s", prefix, path.Base(shell), executor.Ext)
+		stdin   = std.In
+		cmdLine []string
+		fdFile  *os.File
+		err     error
+	)
+	switch mode {
+	case ScriptModeArg:
+		cmdLine = CommandLine(executor, mode, name, text, args)
+	case ScriptModeStdin:
+		cmdLine = CommandLine(executor, mode, name, "", args)
+		stdin = strings.NewReader(text)
+	case ScriptModeFD:
+		if fdFile, err = openScriptFD(pattern, text); err != nil {
+			return errorCode, err
 		}
-	}
-	var cmd *exec.Cmd
-
-	// Shebang or env ?
-	//
-	if shell == "#!" {
-		// Try to make the cmd executable
-		//
-		var stat os.FileInfo
-		if stat, err = tmpFile.Stat(); err != nil {
-			log.Fatal(err)
+		defer fdFile.Close()
+		cmdLine = CommandLine(executor, mode, name, "", args)
+	case ScriptModeFile:
+		if opts.Cache && shell == "#!" {
+			entry, file, created, err := cachedScriptFile(executor, text)
+			if err != nil {
+				return errorCode, err
+			}
+			if created {
+				defer pruneScriptCache(entry)
+			}
+			if app.ShowScriptFiles {
+				fmt.Fprintln(app.ErrOut, file)
+			}
+			env = withEnv(env, CacheEntryVar, entry)
+			cmdLine = CommandLine(executor, mode, name, file, args)
+			break
 		}
-		// Add user-executable bit
-		//
-		if err = tmpFile.Chmod(stat.Mode() | 0100); err != nil {
-			log.Fatal(err)
+		fallthrough
+	default:
+		file, err := writeScriptFile(executor, "", pattern, text)
+		if err != nil {
+			return errorCode, err
 		}
-		if err = tmpFile.Close(); err != nil {
-			log.Fatal(err)
+		defer os.Remove(file) // clean up
+		if app.ShowScriptFiles {
+			fmt.Fprintln(app.ErrOut, file)
 		}
+		cmdLine = CommandLine(executor, mode, name, file, args)
+	}
+	cmd := exec.Command(cmdLine[0], cmdLine[1:]...)
 
-		cmd = exec.Command(tmpFile.Name(), args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = std.Out
+	cmd.Stderr = std.Err
+	if fdFile != nil {
+		cmd.ExtraFiles = []*os.File{fdFile} // scriptFD
+	}
+	cmd.Dir = opts.Dir
+	cmd.Env = opts.Environ
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	// Merge passed-in env (and the executor's env) with base environment
+	//
+	for k, v := range executor.Environ(env) {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+	}
+	job := setProcessGroup(cmd, opts.Foreground)
+	var signals chan os.Signal
+	if opts.ForwardSignals {
+		signals = make(chan os.Signal, 1)
+		signal.Notify(signals, ForwardedSignals...)
+		defer signal.Stop(signals)
+	}
+	if err = cmd.Start(); err != nil {
+		return errorCode, err
+	}
+	if job != nil {
+		defer job.restore()
+	}
+	grace := opts.KillGrace
+	if grace <= 0 {
+		grace = config.DefaultKillGrace
+	}
+	done := make(chan struct{})
+	signalled := make(chan bool, 1)
+	go supervise(ctx, cmd, signals, grace, done, signalled)
+	if job != nil {
+		err = job.wait(cmd)
 	} else {
-		cmd = exec.Command("/usr/bin/env", append([]string{shell, tmpFile.Name()}, args...)...)
+		err = cmd.Wait()
 	}
-
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = out
-	cmd.Stderr = os.Stderr
-	cmd.Env = os.Environ()
-	// Merge passed-in env with os environment
+	close(done)
+	// If the script was interrupted, clean up any background processes it started,
+	// as they may ignore the signal (i.e. SIGINT)
 	//
+	if <-signalled || killedBySignal(err) {
+		cleanupGroup(cmd, grace)
+	}
+	if ctx.Err() == context.DeadlineExceeded && parent.Err() == nil {
+		return TimeoutCode, fmt.Errorf("%w after %s", ErrTimeout, opts.Timeout)
+	}
+	return exitCode(err)
+}
+
+// withEnv returns a copy of env, with the variable set.
+//
+func withEnv(env map[string]string, name string, value string) map[string]string {
+	c := make(map[string]string, len(env)+1)
 	for k, v := range env {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+		c[k] = v
 	}
-	_ = cmd.Run()
+	c[name] = value
+	return c
 }
 
-// ExecuteCmdScript executes a command script.
+// pruneScriptCache keeps the script cache within its maximum size, after an entry is added (and its script has run).
+// Errors are logged, as they do not affect the script.
 //
-func ExecuteCmdScript(shell string, script []string, args []string, env map[string]string) {
-	executeScript(shell, script, args, env, "cmd", os.Stdout)
+func pruneScriptCache(entry string) {
+	maxSize, err := ScriptCacheMaxSize()
+	if err == nil {
+		err = PruneScriptCache(maxSize, entry)
+	}
+	if err != nil {
+		log.Printf("script cache: %v", err)
+	}
 }
 
-// ExecuteSubCommand executes a command substitution.
+// logError logs the error, if any, passing through the exit code.
 //
-func ExecuteSubCommand(shell string, command string, env map[string]string, out io.Writer) {
-	executeScript(shell, []string{command}, []string{}, env, "sub", out)
+func logError(code int, err error) int {
+	if err != nil {
+		log.Println(err)
+	}
+	return code
 }
 
-// tempFile
+// supervise watches a running script until done is closed.
+// If ctx is cancelled, SIGTERM is sent to the script's process group.
+// Signals received on the channel are forwarded to the group.
+// Either is followed by SIGKILL if the script has not exited within the grace period.
+// Reports whether the group was signalled.
 //
-func tempFile(pattern string) (*os.File, error) {
-	if tempDir == "" {
-		var err error
-		tempDir, err = ioutil.TempDir("", "runfile-")
-		if err != nil {
-			return nil, err
+func supervise(ctx context.Context, cmd *exec.Cmd, signals <-chan os.Signal, grace time.Duration, done <-chan struct{}, signalled chan<- bool) {
+	var (
+		cancelled = ctx.Done()
+		kill      <-chan time.Time
+	)
+	for {
+		var sig os.Signal
+		select {
+		case <-done:
+			signalled <- kill != nil
+			return
+		case <-kill:
+			signalGroup(cmd, syscall.SIGKILL)
+			<-done
+			signalled <- true
+			return
+		case <-cancelled:
+			cancelled = nil
+			sig = syscall.SIGTERM
+		case sig = <-signals:
+		}
+		if s, ok := sig.(syscall.Signal); ok {
+			signalGroup(cmd, s)
 		}
+		if kill == nil {
+			kill = time.After(grace)
+		}
+	}
+}
+
+// exitCode converts the result of running a script into an exit code.
+// Scripts killed by a signal return 128 + the signal number, per shell convention.
+//
+func exitCode(err error) (int, error) {
+	if err == nil {
+		return 0, nil
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal()), nil
+		}
+		return exitErr.ExitCode(), nil
+	}
+	if statusErr, ok := err.(*statusError); ok {
+		if statusErr.status.Signaled() {
+			return 128 + int(statusErr.status.Signal()), nil
+		}
+		return statusErr.status.ExitStatus(), nil
+	}
+	// Script could not be waited on
+	//
+	return errorCode, err
+}
+
+// killedBySignal returns true if the script was terminated by a signal.
+//
+func killedBySignal(err error) bool {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		status, ok := exitErr.Sys().(syscall.WaitStatus)
+		return ok && status.Signaled()
 	}
-	return ioutil.TempFile(tempDir, pattern)
+	if statusErr, ok := err.(*statusError); ok {
+		return statusErr.status.Signaled()
+	}
+	return false
+}
+
+// statusError reports the failure of a script that was waited on directly, rather than through exec.Cmd.
+//
+type statusError struct {
+	status syscall.WaitStatus
+}
+
+// Error formats the status like exec.ExitError.
+//
+func (e *statusError) Error() string {
+	if e.status.Signaled() {
+		return fmt.Sprintf("signal: %v", e.status.Signal())
+	}
+	return fmt.Sprintf("exit status %d", e.status.ExitStatus())
+}
+
+// ExecuteCmdScript executes a command script within the configured process, returning its exit code.
+// If ctx is cancelled, the script is terminated.
+// Returns an error (and exit code 126) if the script could not be executed,
+// or ErrTimeout (and TimeoutCode) if the script timed out.
+// If opts.Retry is set, a failing script is re-run, with the result of the last attempt returned.
+// The timeout applies to each attempt.
+//
+func ExecuteCmdScript(ctx context.Context, app *config.App, shell string, script []string, args []string, env map[string]string, std *config.Stdio, opts Options) (int, error) {
+	if opts.Retry != nil && opts.Retry.Retries > 0 {
+		return executeWithRetry(ctx, app, shell, script, args, env, std, opts)
+	}
+	return executeScript(ctx, app, shell, script, args, env, "cmd", std, opts)
+}
+
+// ExecuteSubCommand executes a command substitution, delivered to the shell using the mode ("" = default) and executor (nil = default).
+// If ctx is cancelled, the command is terminated.
+//
+func ExecuteSubCommand(ctx context.Context, app *config.App, shell string, mode string, executor *Executor, command string, env map[string]string, out io.Writer) {
+	std := &config.Stdio{In: os.Stdin, Out: out, Err: app.ErrOut}
+	opts := Options{Foreground: true, ForwardSignals: true, KillGrace: app.KillGrace, ScriptMode: mode, Executor: executor}
+	logError(executeScript(ctx, app, shell, []string{command}, []string{}, env, "sub", std, opts))
+}
+
+// ExecuteCompleteScript executes a completion provider, delivered to the shell using the mode ("" = default) and executor (nil = default).
+// The provider is killed if it runs longer than timeout.
+//
+func ExecuteCompleteScript(app *config.App, shell string, mode string, executor *Executor, command string, args []string, env map[string]string, out io.Writer, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	std := &config.Stdio{In: os.Stdin, Out: out, Err: app.ErrOut}
+	opts := Options{ForwardSignals: true, KillGrace: app.KillGrace, ScriptMode: mode, Executor: executor}
+	logError(executeScript(ctx, app, shell, []string{command}, args, env, "complete", std, opts))
 }
@@ -0,0 +1,341 @@
+package exec
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Executor template placeholders
+//
+const (
+	PlaceholderInterpreter = "{interpreter}" // The interpreter, i.e. '/usr/bin/env python3'
+	PlaceholderFlags       = "{flags}"       // The executor's flags
+	PlaceholderFile        = "{file}"        // The script (file name, or as delivered by the script mode)
+	PlaceholderArgs        = "{args}"        // The command's arguments
+)
+
+// DefaultTemplate is the argv template used to invoke an interpreter, unless the executor overrides it.
+//
+var DefaultTemplate = []string{PlaceholderInterpreter, PlaceholderFlags, PlaceholderFile, PlaceholderArgs}
+
+// Executor describes how an interpreter (shell) runs scripts.
+//
+type Executor struct {
+	Name      string            // Shell name, i.e. 'python3'
+	Ext       string            // Script file extension, i.e. '.py'
+	Template  []string          // Argv template, i.e. '{interpreter} run {flags} {file} {args}'; nil = DefaultTemplate
+	Flags     []string          // Flags for the interpreter
+	Env       map[string]string // Environment for the script; the command's exported variables take precedence
+	Modes     []string          // Supported script modes, in order of preference
+	ArgFlag   string            // Flag preceding the script, in ScriptModeArg
+	ArgName   bool              // Pass the script name after the script ($0), in ScriptModeArg
+	StdinArgs []string          // Arguments to read the script from stdin, in ScriptModeStdin
+}
+
+// shellExecutor describes a POSIX shell, which accepts a script with '-c' (setting $0 to the following argument) or on stdin with '-s'.
+//
+func shellExecutor(name string) *Executor {
+	return &Executor{Name: name, Ext: ".sh", Modes: []string{ScriptModeFD, ScriptModeArg, ScriptModeFile, ScriptModeStdin}, ArgFlag: "-c", ArgName: true, StdinArgs: []string{"-s"}}
+}
+
+// scriptExecutor describes a scripting language that accepts a script as an argument (with the flag), or on stdin with '-'.
+// Scripts are given as a temp file, unless fd is set: Some interpreters (i.e. node) resolve the script's path,
+// which fails for the unnamed file of ScriptModeFD.
+//
+func scriptExecutor(name string, ext string, argFlag string, fd bool) *Executor {
+	modes := []string{ScriptModeFile, ScriptModeFD, ScriptModeArg, ScriptModeStdin}
+	if fd {
+		modes[0], modes[1] = ScriptModeFD, ScriptModeFile
+	}
+	return &Executor{Name: name, Ext: ext, Modes: modes, ArgFlag: argFlag, StdinArgs: []string{"-"}}
+}
+
+// executors is the registry of known executors, keyed by shell name.
+// Tools that need a file with the right extension only support ScriptModeFile.
+//
+var executors = map[string]*Executor{
+	"sh":         shellExecutor("sh"),
+	"ash":        shellExecutor("ash"),
+	"bash":       shellExecutor("bash"),
+	"dash":       shellExecutor("dash"),
+	"ksh":        shellExecutor("ksh"),
+	"mksh":       shellExecutor("mksh"),
+	"zsh":        shellExecutor("zsh"),
+	"python":     scriptExecutor("python", ".py", "-c", true),
+	"python2":    scriptExecutor("python2", ".py", "-c", true),
+	"python3":    scriptExecutor("python3", ".py", "-c", true),
+	"node":       scriptExecutor("node", ".js", "-e", false),
+	"perl":       scriptExecutor("perl", ".pl", "-e", false),
+	"ruby":       scriptExecutor("ruby", ".rb", "-e", false),
+	"fish":       {Name: "fish", Ext: ".fish", Modes: []string{ScriptModeFile, ScriptModeFD}},
+	"deno":       {Name: "deno", Ext: ".ts", Template: []string{PlaceholderInterpreter, "run", PlaceholderFlags, PlaceholderFile, PlaceholderArgs}, Modes: []string{ScriptModeFile}},
+	"go":         {Name: "go", Ext: ".go", Template: []string{PlaceholderInterpreter, "run", PlaceholderFlags, PlaceholderFile, PlaceholderArgs}, Modes: []string{ScriptModeFile}},
+	"pwsh":       {Name: "pwsh", Ext: ".ps1", Template: []string{PlaceholderInterpreter, PlaceholderFlags, "-File", PlaceholderFile, PlaceholderArgs}, Flags: []string{"-NoProfile", "-NonInteractive"}, Modes: []string{ScriptModeFile}},
+	"powershell": {Name: "powershell", Ext: ".ps1", Template: []string{PlaceholderInterpreter, PlaceholderFlags, "-File", PlaceholderFile, PlaceholderArgs}, Flags: []string{"-NoProfile", "-NonInteractive"}, Modes: []string{ScriptModeFile}},
+}
+
+// shebangExecutor runs '#!' scripts directly, so they are always delivered as a file.
+//
+var shebangExecutor = &Executor{Name: "#!", Ext: ".sh", Modes: []string{ScriptModeFile}}
+
+// LookupExecutor fetches the executor for the shell from the registry.
+// Shells not in the registry are given a file, with the default template.
+//
+func LookupExecutor(shell string) *Executor {
+	if shell == "#!" {
+		return shebangExecutor
+	}
+	if e, ok := executors[path.Base(shell)]; ok {
+		if e.Name == shell {
+			return e
+		}
+		// Shell given as a path, i.e. '/usr/local/bin/python3'
+		//
+		e = e.clone()
+		e.Name = shell
+		return e
+	}
+	return &Executor{Name: shell, Ext: ".sh", Modes: []string{ScriptModeFile, ScriptModeFD}}
+}
+
+// clone returns a deep copy of the executor.
+//
+func (e *Executor) clone() *Executor {
+	c := *e
+	c.Template = append([]string(nil), e.Template...)
+	c.Flags = append([]string(nil), e.Flags...)
+	c.Modes = append([]string(nil), e.Modes...)
+	c.StdinArgs = append([]string(nil), e.StdinArgs...)
+	c.Env = make(map[string]string, len(e.Env))
+	for k, v := range e.Env {
+		c.Env[k] = v
+	}
+	return &c
+}
+
+// supports returns true if the executor (and platform) supports the script mode.
+//
+func (e *Executor) supports(mode string) bool {
+	switch mode {
+	case ScriptModeArg:
+		if len(e.ArgFlag) == 0 {
+			return false
+		}
+	case ScriptModeStdin:
+		if len(e.StdinArgs) == 0 {
+			return false
+		}
+	case ScriptModeFD:
+		if defaultFileMode != ScriptModeFD {
+			return false
+		}
+	}
+	for _, m := range e.Modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// fileMode returns the executor's preferred mode for delivering a script as a file.
+//
+func (e *Executor) fileMode() string {
+	if e.supports(ScriptModeFD) {
+		for _, m := range e.Modes {
+			if m == ScriptModeFD || m == ScriptModeFile {
+				return m
+			}
+		}
+	}
+	return ScriptModeFile
+}
+
+// ParseExecutor parses an .EXECUTOR declaration, i.e. 'ext=.ts flags="--quiet" env=NO_COLOR=1',
+// applying the settings to a copy of base (nil = a new executor).
+//
+func ParseExecutor(name string, value string, base *Executor) (*Executor, error) {
+	var e *Executor
+	if base != nil {
+		e = base.clone()
+	} else {
+		e = &Executor{Ext: ".sh", Modes: []string{ScriptModeFile, ScriptModeFD}, Env: map[string]string{}}
+	}
+	e.Name = name
+	words, err := SplitWords(value)
+	if err != nil {
+		return nil, err
+	}
+	for _, word := range words {
+		i := strings.IndexRune(word, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("invalid setting '%s': expecting %s", word, executorSettings)
+		}
+		setting, value := strings.ToLower(word[:i]), word[i+1:]
+		switch setting {
+		case "ext":
+			if len(value) > 0 && !strings.HasPrefix(value, ".") {
+				value = "." + value
+			}
+			e.Ext = value
+		case "flags":
+			if e.Flags, err = SplitWords(value); err != nil {
+				return nil, err
+			}
+		case "template":
+			if e.Template, err = SplitWords(value); err != nil {
+				return nil, err
+			}
+			if err = checkTemplate(e.Template); err != nil {
+				return nil, err
+			}
+		case "env":
+			j := strings.IndexRune(value, '=')
+			if j < 1 {
+				return nil, fmt.Errorf("invalid env '%s': expecting env=NAME=value", value)
+			}
+			e.Env[value[:j]] = value[j+1:]
+		case "modes":
+			e.Modes = nil
+			for _, m := range strings.Split(value, ",") {
+				mode, err := ParseScriptMode(m)
+				if err != nil || len(mode) == 0 {
+					return nil, fmt.Errorf("invalid mode '%s': expecting one of '%s'", m, strings.Join(ScriptModes, "', '"))
+				}
+				e.Modes = append(e.Modes, mode)
+			}
+		case "arg":
+			e.ArgFlag = value
+		case "stdin":
+			if e.StdinArgs, err = SplitWords(value); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("invalid setting '%s': expecting %s", word, executorSettings)
+		}
+	}
+	return e, nil
+}
+
+// executorSettings lists the settings accepted by ParseExecutor, for error messages.
+//
+const executorSettings = "ext=, flags=, template=, env=, modes=, arg= or stdin="
+
+// checkTemplate verifies the template only uses known placeholders, and includes the script.
+//
+func checkTemplate(template []string) error {
+	hasFile := false
+	for _, word := range template {
+		if strings.HasPrefix(word, "{") && strings.HasSuffix(word, "}") {
+			switch word {
+			case PlaceholderInterpreter, PlaceholderFlags, PlaceholderArgs:
+			case PlaceholderFile:
+				hasFile = true
+			default:
+				return fmt.Errorf("invalid template placeholder '%s': expecting %s, %s, %s or %s", word, PlaceholderInterpreter, PlaceholderFlags, PlaceholderFile, PlaceholderArgs)
+			}
+		}
+	}
+	if !hasFile {
+		return fmt.Errorf("invalid template: missing %s", PlaceholderFile)
+	}
+	return nil
+}
+
+// WithFlags returns the executor, with the flags added after its own.
+//
+func (e *Executor) WithFlags(flags []string) *Executor {
+	if len(flags) == 0 {
+		return e
+	}
+	c := e.clone()
+	c.Flags = append(c.Flags, flags...)
+	return c
+}
+
+// Environ returns the executor's environment, overridden by env.
+//
+func (e *Executor) Environ(env map[string]string) map[string]string {
+	if len(e.Env) == 0 {
+		return env
+	}
+	merged := make(map[string]string, len(e.Env)+len(env))
+	for k, v := range e.Env {
+		merged[k] = v
+	}
+	for k, v := range env {
+		merged[k] = v
+	}
+	return merged
+}
+
+// String formats the executor as an .EXECUTOR declaration.
+//
+func (e *Executor) String() string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "%s ext=%s", e.Name, e.Ext)
+	if len(e.Template) > 0 {
+		fmt.Fprintf(b, " template=%q", strings.Join(e.Template, " "))
+	}
+	if len(e.Flags) > 0 {
+		fmt.Fprintf(b, " flags=%q", strings.Join(e.Flags, " "))
+	}
+	names := make([]string, 0, len(e.Env))
+	for name := range e.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(b, " env=%s=%s", name, e.Env[name])
+	}
+	fmt.Fprintf(b, " modes=%s", strings.Join(e.Modes, ","))
+	return b.String()
+}
+
+// SplitWords splits the value into words on whitespace, honoring single and double quotes.
+// Within double quotes (and outside of quotes), a backslash escapes the next character.
+//
+func SplitWords(value string) ([]string, error) {
+	var (
+		words  []string
+		word   strings.Builder
+		inWord bool
+		quote  rune
+		escape bool
+	)
+	for _, r := range value {
+		switch {
+		case escape:
+			word.WriteRune(r)
+			escape = false
+		case r == '\\' && quote != '\'':
+			escape, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in '%s'", value)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,112 @@
+//go:build !windows
+// +build !windows
+
+package exec
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/tekwizely/run/internal/term"
+)
+
+// foregroundJob is a script that was handed the terminal.
+//
+type foregroundJob struct {
+	fd   int // The terminal
+	pgrp int // run's process group
+}
+
+// setProcessGroup configures the command to start in its own process group.
+// If foreground is requested, stdin is a terminal and run is in its foreground process group,
+// the terminal is handed to the new group, so the script can read from it and receives ctrl-c directly.
+// Returns the job, or nil if the terminal is not handed over.
+//
+func setProcessGroup(cmd *exec.Cmd, foreground bool) *foregroundJob {
+	attr := &syscall.SysProcAttr{Setpgid: true}
+	cmd.SysProcAttr = attr
+	if !foreground {
+		return nil
+	}
+	f, ok := cmd.Stdin.(*os.File)
+	if !ok || !term.IsTerminal(f) {
+		return nil
+	}
+	fd := int(f.Fd())
+	pgrp, err := term.ForegroundGroup(fd)
+	if err != nil || pgrp != syscall.Getpgrp() {
+		return nil
+	}
+	attr.Foreground = true
+	attr.Ctty = fd
+	return &foregroundJob{fd: fd, pgrp: pgrp}
+}
+
+// restore gives the terminal back to run.
+//
+func (j *foregroundJob) restore() {
+	_ = term.SetForegroundGroup(j.fd, j.pgrp)
+}
+
+// wait waits for the script to exit, passing job control on to run:
+// If the script is stopped (i.e. ctrl-z), run takes back the terminal and stops itself, so the user's shell sees a stopped job.
+// Once run is continued, the terminal is handed back (if run is in the foreground) and the script is continued.
+//
+func (j *foregroundJob) wait(cmd *exec.Cmd) error {
+	pid := cmd.Process.Pid
+	resumed := make(chan os.Signal, 1)
+	signal.Notify(resumed, syscall.SIGCONT)
+	defer signal.Stop(resumed)
+	for {
+		var status syscall.WaitStatus
+		if _, err := syscall.Wait4(pid, &status, syscall.WUNTRACED, nil); err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			return err
+		}
+		if status.Stopped() {
+			j.restore()
+			_ = syscall.Kill(syscall.Getpid(), syscall.SIGTSTP)
+			<-resumed
+			if pgrp, err := term.ForegroundGroup(j.fd); err == nil && pgrp == j.pgrp {
+				_ = term.SetForegroundGroup(j.fd, pid)
+			}
+			_ = syscall.Kill(-pid, syscall.SIGCONT)
+			continue
+		}
+		// The script is already reaped, so this only releases the command's resources (i.e. output copying)
+		//
+		_ = cmd.Wait()
+		if status.Exited() && status.ExitStatus() == 0 {
+			return nil
+		}
+		return &statusError{status: status}
+	}
+}
+
+// signalGroup sends a signal to the command's process group.
+//
+func signalGroup(cmd *exec.Cmd, sig syscall.Signal) {
+	_ = syscall.Kill(-cmd.Process.Pid, sig)
+}
+
+// cleanupGroup terminates any processes remaining in the (exited) command's process group,
+// killing them if they have not exited within the grace period.
+//
+func cleanupGroup(cmd *exec.Cmd, grace time.Duration) {
+	pgid := cmd.Process.Pid
+	if syscall.Kill(-pgid, syscall.SIGTERM) != nil {
+		return // None remaining
+	}
+	for deadline := time.Now().Add(grace); time.Now().Before(deadline); {
+		time.Sleep(50 * time.Millisecond)
+		if syscall.Kill(-pgid, 0) != nil {
+			return
+		}
+	}
+	_ = syscall.Kill(-pgid, syscall.SIGKILL)
+}
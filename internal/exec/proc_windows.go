@@ -0,0 +1,39 @@
+package exec
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// foregroundJob is not supported, the terminal is never handed over.
+//
+type foregroundJob struct{}
+
+// setProcessGroup is a no-op, process groups are not supported.
+//
+func setProcessGroup(_ *exec.Cmd, _ bool) *foregroundJob {
+	return nil
+}
+
+// restore is a no-op.
+//
+func (j *foregroundJob) restore() {
+}
+
+// wait waits for the command.
+//
+func (j *foregroundJob) wait(cmd *exec.Cmd) error {
+	return cmd.Wait()
+}
+
+// signalGroup kills the command, process groups are not supported.
+//
+func signalGroup(cmd *exec.Cmd, _ syscall.Signal) {
+	_ = cmd.Process.Kill()
+}
+
+// cleanupGroup is a no-op, process groups are not supported.
+//
+func cleanupGroup(_ *exec.Cmd, _ time.Duration) {
+}
@@ -0,0 +1,144 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tekwizely/run/internal/config"
+)
+
+// AttemptVar is exported to retried scripts, holding the attempt number (starting at 1).
+//
+const AttemptVar = "RUN_ATTEMPT"
+
+// DefaultRetryBackoff is the delay before the first retry, if not otherwise configured.
+//
+const DefaultRetryBackoff = time.Second
+
+// RetryPolicy configures re-running a command script that fails.
+//
+type RetryPolicy struct {
+	Retries int           // Maximum number of retries, after the first attempt
+	Backoff time.Duration // Delay before the first retry, doubling for each retry after
+	Max     time.Duration // Maximum delay between retries; 0 = no maximum
+	On      []int         // Exit codes to retry on; empty = any failure (see shouldRetry)
+}
+
+// String formats the policy as a RETRY attribute value, i.e. '3 backoff=2s max=30s on=1,75'.
+//
+func (r *RetryPolicy) String() string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "%d backoff=%s", r.Retries, r.Backoff)
+	if r.Max > 0 {
+		fmt.Fprintf(b, " max=%s", r.Max)
+	}
+	if len(r.On) > 0 {
+		codes := make([]string, len(r.On))
+		for i, code := range r.On {
+			codes[i] = strconv.Itoa(code)
+		}
+		fmt.Fprintf(b, " on=%s", strings.Join(codes, ","))
+	}
+	return b.String()
+}
+
+// shouldRetry returns true if the result of an attempt warrants a retry.
+// Scripts that could not be executed are never retried.
+// Without an explicit list of exit codes, any failure is retried except
+// timeouts (124), scripts that could not be run (126, 127) and scripts killed by a signal (128+).
+//
+func (r *RetryPolicy) shouldRetry(code int, err error) bool {
+	if err != nil && !errors.Is(err, ErrTimeout) {
+		return false
+	}
+	if len(r.On) == 0 {
+		return code > 0 && code < errorCode && code != TimeoutCode
+	}
+	for _, on := range r.On {
+		if code == on {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns the (jittered) delay before the given retry (starting at 1).
+// The delay doubles for each retry, up to Max, and is then randomized within its upper half.
+//
+func (r *RetryPolicy) delay(retry int, rnd *rand.Rand) time.Duration {
+	delay := r.Backoff
+	for i := 1; i < retry && (r.Max <= 0 || delay < r.Max); i++ {
+		if delay > math.MaxInt64/2 {
+			break // Avoid overflow
+		}
+		delay *= 2
+	}
+	if r.Max > 0 && delay > r.Max {
+		delay = r.Max
+	}
+	if half := delay / 2; half > 0 {
+		delay = half + time.Duration(rnd.Int63n(int64(half)+1))
+	}
+	return delay
+}
+
+// executeWithRetry executes a command script, re-running it as configured by opts.Retry.
+// The attempt number is exported to the script as AttemptVar.
+// Stops retrying if ctx is cancelled or, when forwarding signals, a signal is received.
+//
+func executeWithRetry(ctx context.Context, app *config.App, shell string, script []string, args []string, env map[string]string, std *config.Stdio, opts Options) (int, error) {
+	retry := opts.Retry
+	var signals chan os.Signal
+	if opts.ForwardSignals {
+		signals = make(chan os.Signal, 1)
+		signal.Notify(signals, ForwardedSignals...)
+		defer signal.Stop(signals)
+	}
+	attemptEnv := make(map[string]string, len(env)+1)
+	for k, v := range env {
+		attemptEnv[k] = v
+	}
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	attempts := retry.Retries + 1
+	for attempt := 1; ; attempt++ {
+		attemptEnv[AttemptVar] = strconv.Itoa(attempt)
+		code, err := executeScript(ctx, app, shell, script, args, attemptEnv, "cmd", std, opts)
+		if attempt >= attempts || !retry.shouldRetry(code, err) || ctx.Err() != nil {
+			return code, err
+		}
+		select {
+		case <-signals:
+			return code, err
+		default:
+		}
+		reason := fmt.Sprintf("exited with code %d", code)
+		if err != nil {
+			reason = err.Error()
+		}
+		delay := retry.delay(attempt, rnd)
+		errOut := std.Err
+		if errOut == nil {
+			errOut = ioutil.Discard
+		}
+		fmt.Fprintf(errOut, "%s: %s: %s, retrying in %s (attempt %d of %d)\n", app.Me, opts.Name, reason, delay.Round(time.Millisecond), attempt+1, attempts)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return code, err
+		case <-signals:
+			timer.Stop()
+			return code, err
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package exec
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Script delivery modes (.SCRIPT_MODE)
+//
+const (
+	ScriptModeFile  = "file"  // Written to a temp file, passed to the interpreter by name
+	ScriptModeStdin = "stdin" // Piped to the interpreter's stdin
+	ScriptModeArg   = "arg"   // Passed as an argument, i.e. 'sh -c <script>'
+	ScriptModeFD    = "fd"    // Passed as an open file, i.e. '/proc/self/fd/3' (Linux only)
+)
+
+// ScriptModes lists the valid script delivery modes.
+//
+var ScriptModes = []string{ScriptModeFile, ScriptModeStdin, ScriptModeArg, ScriptModeFD}
+
+// maxArgScript limits the size of a script passed as an argument, as the size of arguments is limited.
+// Larger scripts are delivered as a file instead.
+//
+const maxArgScript = 64 * 1024
+
+// scriptFD is the file descriptor the script is passed on, in ScriptModeFD (the first of exec.Cmd.ExtraFiles).
+//
+const scriptFD = 3
+
+// ParseScriptMode validates a .SCRIPT_MODE value, returning the normalized mode ("" = default).
+//
+func ParseScriptMode(value string) (string, error) {
+	mode := strings.ToLower(strings.TrimSpace(value))
+	if len(mode) == 0 {
+		return "", nil
+	}
+	for _, m := range ScriptModes {
+		if mode == m {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("invalid value '%s': expecting one of '%s'", value, strings.Join(ScriptModes, "', '"))
+}
+
+// DefaultScriptMode returns the default delivery mode for the executor:
+// The first of its modes supported by the platform, i.e. shells are given an open file on Linux, and the script as an argument ('-c') elsewhere,
+// while most other interpreters are given a temp file.
+//
+func DefaultScriptMode(e *Executor) string {
+	for _, mode := range e.Modes {
+		if e.supports(mode) {
+			return mode
+		}
+	}
+	return e.fileMode()
+}
+
+// ResolveScriptMode determines how the script is delivered to the executor, starting with the requested mode ("" = default).
+// Falls back to a file if the mode is not supported by the executor (or platform), or the script is too large for an argument.
+// '#!' scripts are always delivered as a temp file, as they are executed directly.
+//
+func ResolveScriptMode(e *Executor, mode string, script []string) string {
+	if e.Name == "#!" {
+		return ScriptModeFile
+	}
+	if len(mode) == 0 {
+		mode = DefaultScriptMode(e)
+	}
+	if !e.supports(mode) {
+		return e.fileMode()
+	}
+	if mode == ScriptModeArg {
+		size := 0
+		for _, line := range script {
+			size += len(line)
+		}
+		if size > maxArgScript {
+			return e.fileMode()
+		}
+	}
+	return mode
+}
+
+// CommandLine returns the interpreter command line used to invoke a script, delivered using the (resolved) mode.
+// The executor's template is expanded, with {file} depending on the mode:
+// For ScriptModeArg, script is the script text, for ScriptModeFile it is the script file, otherwise it is ignored.
+// The name is passed as $0 to shells, in ScriptModeArg.
+//
+func CommandLine(e *Executor, mode string, name string, script string, args []string) []string {
+	// Shebang ?
+	//
+	if e.Name == "#!" {
+		return append([]string{script}, args...)
+	}
+	var file []string
+	switch mode {
+	case ScriptModeArg:
+		file = []string{e.ArgFlag, script}
+		if e.ArgName {
+			file = append(file, name)
+		}
+	case ScriptModeStdin:
+		file = e.StdinArgs
+	case ScriptModeFD:
+		file = []string{fmt.Sprintf("/proc/self/fd/%d", scriptFD)}
+	default:
+		file = []string{script}
+	}
+	template := e.Template
+	if len(template) == 0 {
+		template = DefaultTemplate
+	}
+	var cmdLine []string
+	for _, word := range template {
+		switch word {
+		case PlaceholderInterpreter:
+			cmdLine = append(cmdLine, "/usr/bin/env", e.Name)
+		case PlaceholderFlags:
+			cmdLine = append(cmdLine, e.Flags...)
+		case PlaceholderFile:
+			cmdLine = append(cmdLine, file...)
+		case PlaceholderArgs:
+			cmdLine = append(cmdLine, args...)
+		default:
+			cmdLine = append(cmdLine, word)
+		}
+	}
+	return cmdLine
+}
+
+// writeScriptFile writes the script to a temp file in dir ("" = the default temp directory), returning its name.
+// The caller is responsible for removing the file.
+//
+func writeScriptFile(e *Executor, dir string, pattern string, text string) (string, error) {
+	f, err := ioutil.TempFile(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+	if _, err = f.WriteString(text); err == nil && e.Name == "#!" {
+		// Add user-executable bit
+		//
+		var stat os.FileInfo
+		if stat, err = f.Stat(); err == nil {
+			err = f.Chmod(stat.Mode() | 0100)
+		}
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// openScriptFD writes the script to an anonymous (already removed) temp file, returning it ready for reading.
+// As the file has no name, nothing is left behind, even if run is killed.
+//
+func openScriptFD(pattern string, text string) (*os.File, error) {
+	f, err := ioutil.TempFile("", pattern)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Remove(f.Name()); err == nil {
+		if _, err = f.WriteString(text); err == nil {
+			_, err = f.Seek(0, io.SeekStart)
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,5 @@
+package exec
+
+// defaultFileMode delivers scripts as an open file, which leaves nothing behind on disk.
+//
+const defaultFileMode = ScriptModeFD
@@ -0,0 +1,8 @@
+//go:build !linux
+// +build !linux
+
+package exec
+
+// defaultFileMode delivers scripts as a temp file, as ScriptModeFD is not supported.
+//
+const defaultFileMode = ScriptModeFile
@@ -0,0 +1,52 @@
+package exec
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/tekwizely/run/internal/config"
+)
+
+// TestDefaultScriptMode runs interpreter scripts delivered using the executor's default mode.
+//
+func TestDefaultScriptMode(t *testing.T) {
+	tests := []struct {
+		shell  string
+		script string
+	}{
+		{"sh", "echo hello $1\n"},
+		{"python3", "import sys\nprint('hello ' + sys.argv[1])\n"},
+		{"node", "console.log('hello ' + process.argv[2])\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.shell, func(t *testing.T) {
+			if _, err := exec.LookPath(test.shell); err != nil {
+				t.Skipf("%s not installed", test.shell)
+			}
+			var out, errOut bytes.Buffer
+			app := config.NewApp("run", ioutil.Discard)
+			std := &config.Stdio{In: strings.NewReader(""), Out: &out, Err: &errOut}
+			code, err := ExecuteCmdScript(context.Background(), app, test.shell, []string{test.script}, []string{"world"}, nil, std, Options{Name: "hello"})
+			if err != nil || code != 0 {
+				t.Fatalf("mode %s: exit code %d, err %v, stderr %q", DefaultScriptMode(LookupExecutor(test.shell)), code, err, errOut.String())
+			}
+			if got := strings.TrimSpace(out.String()); got != "hello world" {
+				t.Errorf("mode %s: got %q, want %q", DefaultScriptMode(LookupExecutor(test.shell)), got, "hello world")
+			}
+		})
+	}
+}
+
+// TestDefaultScriptModeFile checks that interpreters which resolve the script's path are given a file.
+//
+func TestDefaultScriptModeFile(t *testing.T) {
+	for _, shell := range []string{"node", "perl", "ruby", "fish", "unknown-shell"} {
+		if mode := DefaultScriptMode(LookupExecutor(shell)); mode != ScriptModeFile {
+			t.Errorf("%s: default mode %s, want %s", shell, mode, ScriptModeFile)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package glob
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Match matches a '/'-separated path against a glob pattern.
+// In addition to path.Match syntax, a '**' segment matches zero or more path segments.
+//
+func Match(pattern string, name string) bool {
+	return matchSegments(strings.Split(strings.TrimPrefix(pattern, "./"), "/"), strings.Split(name, "/"))
+}
+
+// matchSegments
+//
+func matchSegments(pattern []string, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Collapse consecutive '**'
+			//
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := range name {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// Expand returns the files under root matching any of the patterns, as sorted '/'-separated paths relative to root.
+// Directories named in skipDirs are not searched.
+//
+func Expand(root string, patterns []string, skipDirs ...string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() {
+			for _, dir := range skipDirs {
+				if info.Name() == dir && file != root {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		for _, pattern := range patterns {
+			if Match(pattern, rel) {
+				files = append(files, rel)
+				break
+			}
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
@@ -21,6 +21,7 @@ type LexContext struct {
 	Fn      LexFn
 	fnStack *list.List
 	Tokens  token.Nexter
+	app     *config.App
 }
 
 // lex delegates incoming lexer calls to the configured fn
@@ -34,10 +35,10 @@ func (ctx *LexContext) lex(l *lexer.Lexer) lexer.Fn {
 			return nil
 		}
 		fn = ctx.fnStack.Remove(ctx.fnStack.Back()).(LexFn)
-		config.TraceFn("Popped lexer function", fn)
+		ctx.app.TraceFn("Popped lexer function", fn)
 	}
 	// assert(fn != nil)
-	config.TraceFn("Calling lexer function", fn)
+	ctx.app.TraceFn("Calling lexer function", fn)
 	ctx.Fn = fn(ctx, l)
 	return ctx.lex
 }
@@ -46,16 +47,17 @@ func (ctx *LexContext) lex(l *lexer.Lexer) lexer.Fn {
 //
 func (ctx *LexContext) PushFn(fn LexFn) {
 	ctx.fnStack.PushBack(fn)
-	config.TraceFn("Pushed lexer function", fn)
+	ctx.app.TraceFn("Pushed lexer function", fn)
 }
 
 // Lex initiates the lexer against a byte array
 //
-func Lex(fileBytes []byte) *LexContext {
+func Lex(app *config.App, fileBytes []byte) *LexContext {
 	reader := newReaderIgnoreCR(bytes.NewReader(fileBytes))
 	ctx := &LexContext{
 		Fn:      LexMain,
 		fnStack: list.New(),
+		app:     app,
 	}
 	ctx.Tokens = lexer.LexRuneReader(reader, ctx.lex)
 	return ctx
@@ -123,13 +125,20 @@ func LexMain(_ *LexContext, l *lexer.Lexer) LexFn {
 	// DotID
 	//
 	case matchDotID(l):
-		l.EmitToken(TokenDotID)
+		name := strings.ToUpper(l.PeekToken())
+		if t, ok := mainDotTokens[name]; ok {
+			l.EmitType(t)
+		} else {
+			l.EmitToken(TokenDotID)
+		}
 	// ID
 	//
 	case matchID(l):
 		name := strings.ToUpper(l.PeekToken())
 		if t, ok := mainTokens[name]; ok {
 			l.EmitType(t)
+		} else if name == "PROFILE" && peekProfileName(l) {
+			l.EmitType(TokenProfile)
 		} else {
 			l.EmitToken(TokenID)
 		}
@@ -454,11 +463,11 @@ func LexDocBlockAttr(_ *LexContext, l *lexer.Lexer) LexFn {
 	return nil
 }
 
-// LexCmdConfigShell lexes a doc block SHELL line
+// LexCmdConfigShell lexes a doc block SHELL line: the shell name, followed by any flags (rest of the line)
 //
 func LexCmdConfigShell(ctx *LexContext, l *lexer.Lexer) LexFn {
 	ignoreSpace(l)
-	ctx.PushFn(LexIgnoreNewline)
+	ctx.PushFn(LexCmdConfigValue)
 	return LexCmdShellName
 }
 
@@ -469,6 +478,13 @@ func LexCmdConfigUsage(_ *LexContext, l *lexer.Lexer) LexFn {
 	return lexDocBlockNQString
 }
 
+// LexCmdConfigValue lexes the remainder of a doc block attribute line as its value
+//
+func LexCmdConfigValue(_ *LexContext, l *lexer.Lexer) LexFn {
+	ignoreSpace(l)
+	return lexDocBlockNQString
+}
+
 // LexCmdConfigOpt matches: name [-l] [--long] [<label>] ["desc"]
 //
 func LexCmdConfigOpt(_ *LexContext, l *lexer.Lexer) LexFn {
@@ -553,6 +569,28 @@ func LexCmdConfigOpt(_ *LexContext, l *lexer.Lexer) LexFn {
 	return lexDocBlockNQString
 }
 
+// LexCmdConfigComplete matches: (optname | argN) script
+//
+func LexCmdConfigComplete(_ *LexContext, l *lexer.Lexer) LexFn {
+	ignoreSpace(l)
+
+	// Option name or positional arg (argN)
+	//
+	if !matchID(l) {
+		l.EmitError("Expecting option name or argN")
+		return nil
+	}
+	l.EmitToken(TokenConfigCompleteName)
+
+	// Whitespace
+	//
+	ignoreSpace(l)
+
+	// Provider script
+	//
+	return lexDocBlockNQString
+}
+
 func lexCmdConfigOptEnd(_ *LexContext, l *lexer.Lexer) LexFn {
 	ignoreSpace(l)
 	ignoreEOL(l)
@@ -573,6 +611,31 @@ func LexCmdShellName(_ *LexContext, l *lexer.Lexer) LexFn {
 	return nil
 }
 
+// LexExecutor lexes an executor declaration: name, followed by the settings (rest of the line)
+//
+func LexExecutor(_ *LexContext, l *lexer.Lexer) LexFn {
+	ignoreSpace(l)
+	if !matchOneOrMore(l, isExecutorName) {
+		l.EmitError("Expecting executor name")
+		return nil
+	}
+	l.EmitToken(TokenID)
+	ignoreSpace(l)
+	return lexDocBlockNQString
+}
+
+// peekProfileName returns true if a name follows on the line, i.e. 'PROFILE prod'.
+// The name itself is lexed as a TokenID.
+// This keeps 'profile' available as a command name.
+//
+func peekProfileName(l *lexer.Lexer) bool {
+	i := 1
+	for l.CanPeek(i) && isSpaceOrTab(l.Peek(i)) {
+		i++
+	}
+	return i > 1 && l.CanPeek(i) && isAlphaUnder(l.Peek(i))
+}
+
 // LexExport lexes a global OR doc block EXPORT line
 //
 func LexExport(_ *LexContext, l *lexer.Lexer) LexFn {
@@ -738,9 +801,9 @@ func matchDotID(l *lexer.Lexer) (ok bool) {
 		}
 	}()
 	if matchRune(l, runeDot) && matchOne(l, isAlpha) {
-		matchZeroOrMore(l, isAlphaNum)
+		matchZeroOrMore(l, isAlphaNumUnder)
 		for matchRune(l, runeDot) {
-			if !matchOneOrMore(l, isAlphaNum) {
+			if !matchOneOrMore(l, isAlphaNumUnder) {
 				return ok
 			}
 		}
@@ -48,14 +48,31 @@ var mainTokens = map[string]token.Type{
 	"EXPORT":  TokenExport,
 }
 
+// Main DotID Tokens
+//
+var mainDotTokens = map[string]token.Type{
+	".EXECUTOR": TokenExecutor,
+}
+
 // Cmd Config Tokens
 //
 var cmdConfigTokens = map[string]token.Type{
-	"SHELL":  TokenConfigShell,
-	"USAGE":  TokenConfigUsage,
-	"OPTION": TokenConfigOpt,
-	"OPT":    TokenConfigOpt,
-	"EXPORT": TokenConfigExport,
+	"SHELL":    TokenConfigShell,
+	"USAGE":    TokenConfigUsage,
+	"OPTION":   TokenConfigOpt,
+	"OPT":      TokenConfigOpt,
+	"EXPORT":   TokenConfigExport,
+	"COMPLETE": TokenConfigComplete,
+	"WATCH":    TokenConfigWatch,
+	"SOURCES":  TokenConfigSources,
+	"OUTPUTS":  TokenConfigOutputs,
+	"TIMEOUT":  TokenConfigTimeout,
+	"RETRY":    TokenConfigRetry,
+	"CONFIRM":  TokenConfigConfirm,
+	"BEFORE":   TokenConfigBefore,
+	"AFTER":    TokenConfigAfter,
+	"FINALLY":  TokenConfigFinally,
+	"CACHE":    TokenConfigCache,
 }
 
 func isAlpha(r rune) bool {
@@ -78,6 +95,10 @@ func isAlphaNumDotUnder(r rune) bool {
 	return (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r == '_' || r == '.'
 }
 
+func isExecutorName(r rune) bool {
+	return isAlphaNumDotUnder(r) || r == '-'
+}
+
 func isHash(r rune) bool {
 	return r == runeHash
 }
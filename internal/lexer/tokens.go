@@ -36,6 +36,8 @@ const (
 
 	TokenExport
 	TokenCommand
+	TokenExecutor
+	TokenProfile
 
 	TokenHashLine
 
@@ -50,6 +52,18 @@ const (
 	TokenConfigOptValue
 	tokenConfigOptEnd
 	TokenConfigExport
+	TokenConfigComplete
+	TokenConfigCompleteName
+	TokenConfigWatch
+	TokenConfigSources
+	TokenConfigOutputs
+	TokenConfigTimeout
+	TokenConfigRetry
+	TokenConfigConfirm
+	TokenConfigBefore
+	TokenConfigAfter
+	TokenConfigFinally
+	TokenConfigCache
 
 	TokenConfigEnd
 
@@ -26,6 +26,8 @@ type parseContext struct {
 	ast     *ast.Ast
 	fn      parseFn
 	fnStack *list.List
+	app     *config.App
+	profile *ast.Profile // PROFILE block being parsed, if any
 }
 
 // parse
@@ -39,10 +41,10 @@ func (ctx *parseContext) parse(p *parser.Parser) parser.Fn {
 			return nil
 		}
 		fn = ctx.fnStack.Remove(ctx.fnStack.Front()).(parseFn)
-		config.TraceFn("Popped parser function", fn)
+		ctx.app.TraceFn("Popped parser function", fn)
 	}
 	// assert(fn != nil)
-	config.TraceFn("Calling parser function", fn)
+	ctx.app.TraceFn("Calling parser function", fn)
 	ctx.fn = fn(ctx, p)
 	return ctx.parse
 }
@@ -51,7 +53,7 @@ func (ctx *parseContext) parse(p *parser.Parser) parser.Fn {
 //
 func (ctx *parseContext) setLexFn(fn lexer.LexFn) {
 	ctx.l.Fn = fn
-	config.TraceFn("Set lexer function", fn)
+	ctx.app.TraceFn("Set lexer function", fn)
 }
 
 // pushLexFn
@@ -64,22 +66,26 @@ func (ctx *parseContext) pushLexFn(fn lexer.LexFn) {
 //
 func (ctx *parseContext) pushFn(fn parseFn) {
 	ctx.fnStack.PushBack(fn)
-	config.TraceFn("Pushed parser function", fn)
+	ctx.app.TraceFn("Pushed parser function", fn)
 }
 
 // Parse delegates incoming parser calls to the configured fn
 //
-func Parse(l *lexer.LexContext) *ast.Ast {
+func Parse(app *config.App, l *lexer.LexContext) *ast.Ast {
 	ctx := &parseContext{
 		l:       l,
 		ast:     ast.NewAST(),
 		fn:      parseMain,
 		fnStack: list.New(),
+		app:     app,
 	}
 	_, err := parser.Parse(l.Tokens, ctx.parse).Next() // No emits
 	if err != nil && err != io.EOF {
 		panic(err)
 	}
+	if ctx.profile != nil {
+		panic(fmt.Sprintf("PROFILE %s: expecting END", ctx.profile.Name))
+	}
 	return ctx.ast
 }
 
@@ -88,7 +94,6 @@ func Parse(l *lexer.LexContext) *ast.Ast {
 func parseMain(ctx *parseContext, p *parser.Parser) parseFn {
 	var (
 		name      string
-		valueList ast.ScopeValueNode
 		cmdConfig *ast.CmdConfig
 		ok        bool
 	)
@@ -99,6 +104,112 @@ func parseMain(ctx *parseContext, p *parser.Parser) parseFn {
 		p.Clear()
 		return parseMain
 	}
+	// Executor
+	//
+	if tryPeekType(p, lexer.TokenExecutor) {
+		p.Next()
+		ctx.pushLexFn(ctx.l.Fn)
+		ctx.setLexFn(lexer.LexExecutor)
+		name = expectTokenType(p, lexer.TokenID, "Expecting executor name").Value()
+		ctx.ast.AddScopeNode(&ast.ScopeExecutor{Name: name, Value: expectDocNQString(ctx, p)})
+		return parseMain
+	}
+	// Profile
+	//
+	if tryPeekType(p, lexer.TokenProfile) {
+		p.Next()
+		name = expectTokenType(p, lexer.TokenID, "Expecting profile name").Value()
+		expectTokenType(p, lexer.TokenNewline, "expecting end of line")
+		p.Clear()
+		ctx.profile = &ast.Profile{Name: name, Ast: ast.NewAST()}
+		return parseProfile
+	}
+	// Doc Line
+	//
+	if tryPeekType(p, lexer.TokenConfigDescLine) {
+		line := p.Next()
+		cmdConfig = &ast.CmdConfig{}
+		cmdConfig.Desc = append(cmdConfig.Desc, &ast.ScopeValueRunes{Value: line.Value()})
+		p.Clear()
+		tryMatchCmd(ctx, p, cmdConfig)
+		return parseMain
+	}
+	// Doc Block
+	//
+	if cmdConfig, ok = tryMatchDocBlock(ctx, p); ok {
+		// Command?
+		//
+		tryMatchCmd(ctx, p, cmdConfig)
+		return parseMain
+	}
+	// Assignment
+	//
+	if tryMatchAssignment(ctx, p, ctx.ast) {
+		return parseMain
+	}
+	// Command
+	//
+	if ok = tryMatchCmd(ctx, p, nil); ok {
+		return parseMain
+	}
+	if p.CanPeek(1) {
+		t := p.Peek(1)
+		panic(fmt.Sprintf("%d:%d: Expecting command header", t.Line(), t.Column()))
+	} else {
+		panic("Expecting command header")
+	}
+}
+
+// parseProfile parses the assignments of a PROFILE block, up to its END line.
+//
+func parseProfile(ctx *parseContext, p *parser.Parser) parseFn {
+	// Newline
+	//
+	if tryPeekType(p, lexer.TokenNewline) {
+		p.Next()
+		p.Clear()
+		return parseProfile
+	}
+	// END
+	//
+	if tryMatchProfileEnd(p) {
+		ctx.ast.Add(ctx.profile)
+		ctx.profile = nil
+		return parseMain
+	}
+	// Assignment
+	//
+	if tryMatchAssignment(ctx, p, ctx.profile.Ast) {
+		return parseProfile
+	}
+	panic(parseError(p, fmt.Sprintf("PROFILE %s: expecting assignment or END", ctx.profile.Name)))
+}
+
+// tryMatchProfileEnd matches the END line of a PROFILE block.
+//
+func tryMatchProfileEnd(p *parser.Parser) bool {
+	if p.CanPeek(1) &&
+		p.PeekType(1) == lexer.TokenID &&
+		strings.EqualFold(p.Peek(1).Value(), "END") &&
+		(!p.CanPeek(2) || p.PeekType(2) == lexer.TokenNewline) {
+		p.Next()
+		if tryPeekType(p, lexer.TokenNewline) {
+			p.Next()
+		}
+		p.Clear()
+		return true
+	}
+	return false
+}
+
+// tryMatchAssignment matches an EXPORT, attribute or variable assignment, adding it to the ast.
+//
+func tryMatchAssignment(ctx *parseContext, p *parser.Parser, a *ast.Ast) bool {
+	var (
+		name      string
+		valueList ast.ScopeValueNode
+		ok        bool
+	)
 	// Export
 	//
 	if tryPeekType(p, lexer.TokenExport) {
@@ -113,8 +224,8 @@ func parseMain(ctx *parseContext, p *parser.Parser) parseFn {
 		case tryPeekType(p, lexer.TokenEquals):
 			p.Next()
 			if valueList, ok = tryMatchAssignmentValue(ctx, p); ok {
-				ctx.ast.AddScopeNode(&ast.ScopeVarAssignment{Name: name, Value: valueList})
-				ctx.ast.AddScopeNode(&ast.ScopeExportList{Names: []string{name}})
+				a.AddScopeNode(&ast.ScopeVarAssignment{Name: name, Value: valueList})
+				a.AddScopeNode(&ast.ScopeExportList{Names: []string{name}})
 			} else {
 				panic("expecting assignment values")
 			}
@@ -123,8 +234,8 @@ func parseMain(ctx *parseContext, p *parser.Parser) parseFn {
 		case tryPeekType(p, lexer.TokenQMarkEquals):
 			p.Next()
 			if valueList, ok = tryMatchAssignmentValue(ctx, p); ok {
-				ctx.ast.AddScopeNode(&ast.ScopeVarQAssignment{Name: name, Value: valueList})
-				ctx.ast.AddScopeNode(&ast.ScopeExportList{Names: []string{name}})
+				a.AddScopeNode(&ast.ScopeVarQAssignment{Name: name, Value: valueList})
+				a.AddScopeNode(&ast.ScopeExportList{Names: []string{name}})
 			} else {
 				panic("expecting assignment values")
 			}
@@ -138,29 +249,11 @@ func parseMain(ctx *parseContext, p *parser.Parser) parseFn {
 				name = expectTokenType(p, lexer.TokenID, "Expecting TokenID").Value()
 				exportList.Names = append(exportList.Names, name)
 			}
-			ctx.ast.AddScopeNode(exportList)
+			a.AddScopeNode(exportList)
 		}
 		expectTokenType(p, lexer.TokenNewline, "expecting end of line")
 		p.Clear()
-		return parseMain
-	}
-	// Doc Line
-	//
-	if tryPeekType(p, lexer.TokenConfigDescLine) {
-		line := p.Next()
-		cmdConfig = &ast.CmdConfig{}
-		cmdConfig.Desc = append(cmdConfig.Desc, &ast.ScopeValueRunes{Value: line.Value()})
-		p.Clear()
-		tryMatchCmd(ctx, p, cmdConfig)
-		return parseMain
-	}
-	// Doc Block
-	//
-	if cmdConfig, ok = tryMatchDocBlock(ctx, p); ok {
-		// Command?
-		//
-		tryMatchCmd(ctx, p, cmdConfig)
-		return parseMain
+		return true
 	}
 	// DotAssignment
 	//
@@ -170,8 +263,8 @@ func parseMain(ctx *parseContext, p *parser.Parser) parseFn {
 			// Let's go ahead and normalize this now
 			//
 			name = strings.ToUpper(name)
-			ctx.ast.AddScopeNode(&ast.ScopeAttrAssignment{Name: name, Value: valueList})
-			return parseMain
+			a.AddScopeNode(&ast.ScopeAttrAssignment{Name: name, Value: valueList})
+			return true
 		}
 		panic("expecting assignment value")
 	}
@@ -180,8 +273,8 @@ func parseMain(ctx *parseContext, p *parser.Parser) parseFn {
 	if name, ok = tryMatchAssignmentStart(p); ok {
 		ctx.pushLexFn(ctx.l.Fn)
 		if valueList, ok = tryMatchAssignmentValue(ctx, p); ok {
-			ctx.ast.AddScopeNode(&ast.ScopeVarAssignment{Name: name, Value: valueList})
-			return parseMain
+			a.AddScopeNode(&ast.ScopeVarAssignment{Name: name, Value: valueList})
+			return true
 		}
 		panic("expecting assignment value")
 	}
@@ -190,22 +283,12 @@ func parseMain(ctx *parseContext, p *parser.Parser) parseFn {
 	if name, ok = tryMatchQAssignmentStart(p); ok {
 		ctx.pushLexFn(ctx.l.Fn)
 		if valueList, ok = tryMatchAssignmentValue(ctx, p); ok {
-			ctx.ast.AddScopeNode(&ast.ScopeVarQAssignment{Name: name, Value: valueList})
-			return parseMain
+			a.AddScopeNode(&ast.ScopeVarQAssignment{Name: name, Value: valueList})
+			return true
 		}
 		panic("expecting assignment value")
 	}
-	// Command
-	//
-	if ok = tryMatchCmd(ctx, p, nil); ok {
-		return parseMain
-	}
-	if p.CanPeek(1) {
-		t := p.Peek(1)
-		panic(fmt.Sprintf("%d:%d: Expecting command header", t.Line(), t.Column()))
-	} else {
-		panic("Expecting command header")
-	}
+	return false
 }
 
 // tryMatchCmd
@@ -274,6 +357,7 @@ func tryMatchDocBlock(ctx *parseContext, p *parser.Parser) (*ast.CmdConfig, bool
 				ctx.setLexFn(lexer.LexCmdConfigShell)
 				shell := expectTokenType(p, lexer.TokenID, "Expecting TokenID")
 				cmdConfig.Shell = shell.Value()
+				cmdConfig.ShellFlags = expectDocNQString(ctx, p)
 			case lexer.TokenConfigUsage:
 				p.Next()
 				ctx.pushLexFn(ctx.l.Fn)
@@ -298,6 +382,76 @@ func tryMatchDocBlock(ctx *parseContext, p *parser.Parser) (*ast.CmdConfig, bool
 				}
 				opt.Desc = expectDocNQString(ctx, p)
 				cmdConfig.Opts = append(cmdConfig.Opts, opt)
+			case lexer.TokenConfigComplete:
+				p.Next()
+				complete := &ast.CmdComplete{}
+				ctx.pushLexFn(ctx.l.Fn)
+				ctx.setLexFn(lexer.LexCmdConfigComplete)
+				complete.Target = expectTokenType(p, lexer.TokenConfigCompleteName, "Expecting TokenConfigCompleteName").Value()
+				complete.Script = expectDocNQString(ctx, p)
+				cmdConfig.Completes = append(cmdConfig.Completes, complete)
+			case lexer.TokenConfigWatch:
+				p.Next()
+				ctx.pushLexFn(ctx.l.Fn)
+				ctx.setLexFn(lexer.LexCmdConfigValue)
+				cmdConfig.Watches = append(cmdConfig.Watches, expectDocNQString(ctx, p))
+			case lexer.TokenConfigSources:
+				p.Next()
+				ctx.pushLexFn(ctx.l.Fn)
+				ctx.setLexFn(lexer.LexCmdConfigValue)
+				cmdConfig.Sources = append(cmdConfig.Sources, expectDocNQString(ctx, p))
+			case lexer.TokenConfigOutputs:
+				p.Next()
+				ctx.pushLexFn(ctx.l.Fn)
+				ctx.setLexFn(lexer.LexCmdConfigValue)
+				cmdConfig.Outputs = append(cmdConfig.Outputs, expectDocNQString(ctx, p))
+			case lexer.TokenConfigTimeout:
+				p.Next()
+				if cmdConfig.Timeout != nil {
+					panic(fmt.Sprintf("%d:%d: TIMEOUT already defined", t.Line(), t.Column()))
+				}
+				ctx.pushLexFn(ctx.l.Fn)
+				ctx.setLexFn(lexer.LexCmdConfigValue)
+				cmdConfig.Timeout = expectDocNQString(ctx, p)
+			case lexer.TokenConfigRetry:
+				p.Next()
+				if cmdConfig.Retry != nil {
+					panic(fmt.Sprintf("%d:%d: RETRY already defined", t.Line(), t.Column()))
+				}
+				ctx.pushLexFn(ctx.l.Fn)
+				ctx.setLexFn(lexer.LexCmdConfigValue)
+				cmdConfig.Retry = expectDocNQString(ctx, p)
+			case lexer.TokenConfigConfirm:
+				p.Next()
+				if cmdConfig.Confirm != nil {
+					panic(fmt.Sprintf("%d:%d: CONFIRM already defined", t.Line(), t.Column()))
+				}
+				ctx.pushLexFn(ctx.l.Fn)
+				ctx.setLexFn(lexer.LexCmdConfigValue)
+				cmdConfig.Confirm = expectDocNQString(ctx, p)
+			case lexer.TokenConfigBefore:
+				p.Next()
+				ctx.pushLexFn(ctx.l.Fn)
+				ctx.setLexFn(lexer.LexCmdConfigValue)
+				cmdConfig.Before = append(cmdConfig.Before, expectDocNQString(ctx, p))
+			case lexer.TokenConfigAfter:
+				p.Next()
+				ctx.pushLexFn(ctx.l.Fn)
+				ctx.setLexFn(lexer.LexCmdConfigValue)
+				cmdConfig.After = append(cmdConfig.After, expectDocNQString(ctx, p))
+			case lexer.TokenConfigFinally:
+				p.Next()
+				ctx.pushLexFn(ctx.l.Fn)
+				ctx.setLexFn(lexer.LexCmdConfigValue)
+				cmdConfig.Finally = append(cmdConfig.Finally, expectDocNQString(ctx, p))
+			case lexer.TokenConfigCache:
+				p.Next()
+				if cmdConfig.Cache != nil {
+					panic(fmt.Sprintf("%d:%d: CACHE already defined", t.Line(), t.Column()))
+				}
+				ctx.pushLexFn(ctx.l.Fn)
+				ctx.setLexFn(lexer.LexCmdConfigValue)
+				cmdConfig.Cache = expectDocNQString(ctx, p)
 			case lexer.TokenConfigExport:
 				p.Next()
 				ctx.pushLexFn(ctx.l.Fn)
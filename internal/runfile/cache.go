@@ -0,0 +1,111 @@
+package runfile
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/tekwizely/run/internal/config"
+	"github.com/tekwizely/run/internal/exec"
+)
+
+// RunCache manages the script cache used by CACHE commands.
+// 'cache' shows the cache location and size, while 'cache clean' removes cached scripts,
+// either all of them, or the least recently used until the cache is within '--max-size'.
+// Output is written to std.Out.
+//
+func RunCache(app *config.App, args []string, std *config.Stdio) int {
+	var maxSize string
+	flags := flag.NewFlagSet("cache", flag.ExitOnError)
+	flags.SetOutput(app.ErrOut)
+	flags.Usage = func() {
+		fmt.Fprintf(app.ErrOut, "Usage: %s cache [clean [--max-size <size>]]\n", app.Me)
+		os.Exit(2)
+	}
+	flags.StringVar(&maxSize, "max-size", "", "")
+	// Options may come before or after the action
+	//
+	_ = flags.Parse(args)
+	args = flags.Args()
+	if len(args) == 0 {
+		if len(maxSize) > 0 {
+			log.Printf("--max-size: expecting 'clean'")
+			flags.Usage()
+		}
+		return showCache(app, std.Out)
+	}
+	if !strings.EqualFold(args[0], "clean") {
+		log.Printf("unknown cache action: %s", args[0])
+		flags.Usage()
+	}
+	_ = flags.Parse(args[1:])
+	if flags.NArg() > 0 {
+		flags.Usage()
+	}
+	if len(maxSize) > 0 {
+		size, err := exec.ParseSize(maxSize)
+		if err != nil {
+			log.Printf("--max-size: %v", err)
+			flags.Usage()
+		}
+		if err = exec.PruneScriptCache(size, ""); err != nil {
+			log.Fatal(err)
+		}
+		return showCache(app, std.Out)
+	}
+	count, err := exec.CleanScriptCache()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintf(std.Out, "Removed %d cached script(s)\n", count)
+	return 0
+}
+
+// showCache prints the location, size and size limit of the script cache.
+//
+func showCache(_ *config.App, out io.Writer) int {
+	dir, err := exec.ScriptCacheDir()
+	if err != nil {
+		log.Fatal(err)
+	}
+	entries, err := exec.ScriptCacheEntries()
+	if err != nil {
+		log.Fatal(err)
+	}
+	maxSize, err := exec.ScriptCacheMaxSize()
+	if err != nil {
+		log.Fatal(err)
+	}
+	var total int64
+	for _, entry := range entries {
+		total += entry.Size
+	}
+	limit := "none"
+	if maxSize > 0 {
+		limit = formatSize(maxSize)
+	}
+	fmt.Fprintf(out, "Directory: %s\n", dir)
+	fmt.Fprintf(out, "Scripts:   %d\n", len(entries))
+	fmt.Fprintf(out, "Size:      %s (limit %s)\n", formatSize(total), limit)
+	return 0
+}
+
+// formatSize formats a size in bytes, i.e. '1.5M'.
+//
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	value, suffix := float64(size)/unit, "K"
+	for _, s := range []string{"M", "G"} {
+		if value < unit {
+			break
+		}
+		value, suffix = value/unit, s
+	}
+	return fmt.Sprintf("%.1f%s", value, suffix)
+}
@@ -0,0 +1,85 @@
+package runfile
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tekwizely/run/internal/config"
+)
+
+// CLIVarsAttr names the attribute that enables variable overrides from the command line.
+//
+const CLIVarsAttr = ".CLI_VARS"
+
+// ParseCLIVar parses a command-line variable, i.e. 'VERSION=1.2'.
+// Returns false if the argument is not a valid assignment.
+//
+func ParseCLIVar(arg string) (string, string, bool) {
+	i := strings.IndexRune(arg, '=')
+	if i < 1 {
+		return "", "", false
+	}
+	name := arg[:i]
+	for j, r := range name {
+		if !(r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (j > 0 && r >= '0' && r <= '9')) {
+			return "", "", false
+		}
+	}
+	return name, arg[i+1:], true
+}
+
+// SplitCLIVars splits trailing 'NAME=value' arguments from the arguments, returning the remaining arguments and the variables.
+// The first argument (the command name) is never considered a variable.
+//
+func SplitCLIVars(args []string) ([]string, map[string]string) {
+	vars := map[string]string{}
+	i := len(args)
+	for i > 1 {
+		if _, _, ok := ParseCLIVar(args[i-1]); !ok {
+			break
+		}
+		i--
+	}
+	for _, arg := range args[i:] {
+		name, value, _ := ParseCLIVar(arg)
+		vars[name] = value
+	}
+	return args[:i], vars
+}
+
+// CLIVarsEnabled returns true if the scope enables command-line variable overrides (.CLI_VARS).
+// Panics if .CLI_VARS is not a boolean.
+//
+func CLIVarsEnabled(s *Scope) bool {
+	value, ok := s.GetAttr(CLIVarsAttr)
+	if !ok || len(strings.TrimSpace(value)) == 0 {
+		return false
+	}
+	enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		panic(fmt.Sprintf("%s: invalid value '%s': expecting 'true' or 'false'", CLIVarsAttr, value))
+	}
+	return enabled
+}
+
+// CLIVar fetches the command-line override for a variable, if the scope enables them.
+//
+func CLIVar(app *config.App, s *Scope, name string) (string, bool) {
+	if len(app.CLIVars) == 0 || !CLIVarsEnabled(s) {
+		return "", false
+	}
+	value, ok := app.CLIVars[name]
+	return value, ok
+}
+
+// ApplyCLIVars (re-)applies the command-line overrides to the scope, if the scope enables them.
+//
+func ApplyCLIVars(app *config.App, s *Scope) {
+	if len(app.CLIVars) == 0 || !CLIVarsEnabled(s) {
+		return
+	}
+	for name, value := range app.CLIVars {
+		s.PutVar(name, value)
+	}
+}
@@ -1,12 +1,15 @@
 package runfile
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/tekwizely/run/internal/config"
 	"github.com/tekwizely/run/internal/exec"
@@ -182,26 +185,20 @@ func (a *boolOpt) IsBoolFlag() bool {
 	return true
 }
 
-// evaluateCmdOpts
+// cmdFlags wraps a flag set configured from a command's options.
 //
-func evaluateCmdOpts(cmd *RunCmd, args []string) []string {
-	flags := flag.NewFlagSet(cmd.Name, flag.ExitOnError)
-	// Invoked if error parsing arguments.
-	//
-	flags.Usage = func() {
-		// Show less verbose usage.
-		// User can use -h/--help for full desc+usage
-		//
-		showCmdUsage(cmd)
-		os.Exit(2)
-	}
-	var (
-		stringVals = make(map[string]*stringOpt)
-		boolVals   = make(map[string]*boolOpt)
-	)
+type cmdFlags struct {
+	*flag.FlagSet
+	opts []cmdFlagOpt
+	help bool
+}
+
+// newCmdFlags creates a flag set for the command's options, adding -h/--help if not explicitly configured.
+//
+func newCmdFlags(cmd *RunCmd, errorHandling flag.ErrorHandling) *cmdFlags {
+	flags := &cmdFlags{FlagSet: flag.NewFlagSet(cmd.Name, errorHandling)}
 	// Help : -h, --help
 	//
-	help := false
 	hasHelpShort := false
 	hasHelpLong := false
 	for _, opt := range cmd.Config.Opts {
@@ -220,15 +217,12 @@ func evaluateCmdOpts(cmd *RunCmd, args []string) []string {
 		//
 		if len(opt.Value) > 0 {
 			var s = new(string)
-			var sOpt = &stringOpt{name: optName, value: s}
-			stringVals[optName] = sOpt
-			flagOpt = sOpt
+			flagOpt = &stringOpt{name: optName, value: s}
 		} else {
 			var b = new(bool)
-			var bOpt = &boolOpt{name: optName, value: b}
-			boolVals[optName] = bOpt
-			flagOpt = bOpt
+			flagOpt = &boolOpt{name: optName, value: b}
 		}
+		flags.opts = append(flags.opts, flagOpt)
 		// Short?
 		//
 		if opt.Short != 0 {
@@ -241,66 +235,115 @@ func evaluateCmdOpts(cmd *RunCmd, args []string) []string {
 		}
 	}
 	if !hasHelpShort {
-		flags.BoolVar(&help, "h", help, "")
+		flags.BoolVar(&flags.help, "h", flags.help, "")
 	}
 	if !hasHelpLong {
-		flags.BoolVar(&help, "help", help, "")
+		flags.BoolVar(&flags.help, "help", flags.help, "")
 	}
-	_ = flags.Parse(args)
-	// User explicitly asked for help
+	return flags
+}
+
+// exportOpts stashes the option values into the command scope as exported variables.
+//
+func (flags *cmdFlags) exportOpts(cmd *RunCmd) {
+	// TODO Maybe make args property instead of stashing in vars?
+	for _, opt := range flags.opts {
+		cmd.Scope.Vars[opt.Name()] = opt.String()
+		cmd.Scope.AddExport(opt.Name())
+	}
+}
+
+// undefinedFlagPrefix prefixes the flag package's error for an unknown option.
+//
+const undefinedFlagPrefix = "flag provided but not defined: "
+
+// ParseCmdOpts parses the command's options, stashing their values into the command scope as exported variables.
+// Returns the remaining (positional) arguments.
+// Returns flag.ErrHelp if -h/--help was requested.
+//
+func ParseCmdOpts(cmd *RunCmd, args []string) ([]string, error) {
+	flags := newCmdFlags(cmd, flag.ContinueOnError)
+	// Errors are returned rather than printed
 	//
-	if help {
+	flags.SetOutput(ioutil.Discard)
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.help {
+		return nil, flag.ErrHelp
+	}
+	flags.exportOpts(cmd)
+	return flags.Args(), nil
+}
+
+// evaluateCmdOpts
+//
+func evaluateCmdOpts(app *config.App, cmd *RunCmd, args []string) []string {
+	args, err := ParseCmdOpts(cmd, args)
+	switch {
+	case err == flag.ErrHelp:
+		// User explicitly asked for help
 		// Show full help details
 		//
-		ShowCmdHelp(cmd)
+		ShowCmdHelp(app, cmd)
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintln(app.ErrOut, err)
+		if name := strings.TrimPrefix(err.Error(), undefinedFlagPrefix); name != err.Error() {
+			showSuggestions(app, suggestOpts(cmd, name))
+		}
+		// Show less verbose usage.
+		// User can use -h/--help for full desc+usage
+		//
+		showCmdUsage(app, cmd)
 		os.Exit(2)
 	}
-	// TODO Maybe make args property instead of stashing in vars?
-	for name, value := range stringVals {
-		cmd.Scope.Vars[name] = value.String()
-		cmd.Scope.AddExport(name)
-	}
-	for name, value := range boolVals {
-		cmd.Scope.Vars[name] = value.String()
-		cmd.Scope.AddExport(name)
-	}
-	return flags.Args()
+	return args
+}
+
+// CheckCmdArgs validates the command's options, showing usage and exiting on error.
+//
+func CheckCmdArgs(app *config.App, cmd *RunCmd, args []string) {
+	evaluateCmdOpts(app, cmd.Clone(), args)
 }
 
 // ShowCmdHelp shows cmd, desc, usage and opts
 //
-func ShowCmdHelp(cmd *RunCmd) {
+func ShowCmdHelp(app *config.App, cmd *RunCmd) {
 	var shell = ""
-	if config.ShowCmdShells {
+	if app.ShowCmdShells {
 		shell = fmt.Sprintf(" (%s)", cmd.Shell())
 	}
 
 	if !cmd.EnableHelp() {
-		fmt.Fprintf(config.ErrOut, "%s%s: No help available.\n", cmd.Name, shell)
+		fmt.Fprintf(app.ErrOut, "%s%s: No help available.\n", cmd.Name, shell)
 		return
 	}
-	fmt.Fprintf(config.ErrOut, "%s%s:\n", cmd.Name, shell)
+	fmt.Fprintf(app.ErrOut, "%s%s:\n", cmd.Name, shell)
 	// Desc
 	//
 	if len(cmd.Config.Desc) > 0 {
 		for _, desc := range cmd.Config.Desc {
-			fmt.Fprintf(config.ErrOut, "  %s\n", desc)
+			fmt.Fprintf(app.ErrOut, "  %s\n", desc)
 		}
 		// } else {
 		// 	fmt.Fprintf(errOut, "%s:\n", cmd.name)
 	}
-	showCmdUsage(cmd)
+	showCmdUsage(app, cmd)
+	if len(app.Profile) > 0 {
+		fmt.Fprintf(app.ErrOut, "Profile: %s\n", app.Profile)
+	}
 }
 
 // ShowCmdUsage show only usage + opts
 //
-func showCmdUsage(cmd *RunCmd) {
+func showCmdUsage(app *config.App, cmd *RunCmd) {
 	var shell = ""
-	if config.ShowCmdShells {
+	if app.ShowCmdShells {
 		shell = fmt.Sprintf(" (%s)", cmd.Shell())
 	}
 	if !cmd.EnableHelp() {
-		fmt.Fprintf(config.ErrOut, "%s%s: No help available.\n", cmd.Name, shell)
+		fmt.Fprintf(app.ErrOut, "%s%s: No help available.\n", cmd.Name, shell)
 		return
 	}
 	// Usages
@@ -308,14 +351,14 @@ func showCmdUsage(cmd *RunCmd) {
 	for i, usage := range cmd.Config.Usages {
 		or := "or"
 		if i == 0 {
-			fmt.Fprintf(config.ErrOut, "Usage:\n")
+			fmt.Fprintf(app.ErrOut, "Usage:\n")
 			or = "  " // 2 spaces
 		}
 		pad := strings.Repeat(" ", len(cmd.Name)-1)
 		if usage[0] == '(' {
-			fmt.Fprintf(config.ErrOut, "       %s %s\n", pad, usage)
+			fmt.Fprintf(app.ErrOut, "       %s %s\n", pad, usage)
 		} else {
-			fmt.Fprintf(config.ErrOut, "  %s   %s %s\n", or, cmd.Name, usage)
+			fmt.Fprintf(app.ErrOut, "  %s   %s %s\n", or, cmd.Name, usage)
 		}
 	}
 	hasHelpShort := false
@@ -331,39 +374,23 @@ func showCmdUsage(cmd *RunCmd) {
 	// Options
 	//
 	if len(cmd.Config.Opts) > 0 {
-		fmt.Fprintln(config.ErrOut, "Options:")
+		fmt.Fprintln(app.ErrOut, "Options:")
 		if !hasHelpShort || !hasHelpLong {
 			switch {
 			case !hasHelpShort && hasHelpLong:
-				fmt.Fprintln(config.ErrOut, "  -h")
+				fmt.Fprintln(app.ErrOut, "  -h")
 			case hasHelpShort && !hasHelpLong:
-				fmt.Fprintln(config.ErrOut, "  --help")
+				fmt.Fprintln(app.ErrOut, "  --help")
 			default:
-				fmt.Fprintln(config.ErrOut, "  -h, --help")
+				fmt.Fprintln(app.ErrOut, "  -h, --help")
 			}
-			fmt.Fprintln(config.ErrOut, "        Show full help screen")
+			fmt.Fprintln(app.ErrOut, "        Show full help screen")
 		}
 	}
 	for _, opt := range cmd.Config.Opts {
 		b := &strings.Builder{}
 		b.WriteString("  ")
-		if opt.Short != 0 {
-			b.WriteRune('-')
-			b.WriteRune(opt.Short)
-		}
-		if opt.Long != "" {
-			if opt.Short != 0 {
-				b.WriteString(", ")
-			}
-			b.WriteString("--")
-			b.WriteString(opt.Long)
-		}
-		if opt.Value != "" {
-			b.WriteRune(' ')
-			b.WriteRune('<')
-			b.WriteString(opt.Value)
-			b.WriteRune('>')
-		}
+		b.WriteString(opt.Flags())
 		if opt.Desc != "" {
 			if opt.Short != 0 && opt.Long == "" && opt.Value == "" {
 				b.WriteString("    ")
@@ -372,59 +399,82 @@ func showCmdUsage(cmd *RunCmd) {
 			}
 			b.WriteString(opt.Desc)
 		}
-		fmt.Fprintln(config.ErrOut, b.String())
+		fmt.Fprintln(app.ErrOut, b.String())
 	}
 }
 
 // ListCommands prints the list of commands read from the runfile
 //
-func ListCommands() {
-	fmt.Fprintln(config.ErrOut, "Commands:")
+func ListCommands(app *config.App) {
+	fmt.Fprintln(app.ErrOut, "Commands:")
 	padLen := 0
-	for _, cmd := range config.CommandList {
+	for _, cmd := range app.CommandList {
 		if len(cmd.Name) > padLen {
 			padLen = len(cmd.Name)
 		}
 	}
-	for _, cmd := range config.CommandList {
-		fmt.Fprintf(config.ErrOut, "  %s%s    %s\n", cmd.Name, strings.Repeat(" ", padLen-len(cmd.Name)), cmd.Title)
+	var globalCmds []*config.Command
+	for _, cmd := range app.CommandList {
+		if cmd.Global {
+			globalCmds = append(globalCmds, cmd)
+			continue
+		}
+		fmt.Fprintf(app.ErrOut, "  %s%s    %s\n", cmd.Name, strings.Repeat(" ", padLen-len(cmd.Name)), cmd.Title)
 	}
-	pad := strings.Repeat(" ", len(config.Me)-1)
+	if len(globalCmds) > 0 {
+		fmt.Fprintln(app.ErrOut, "Global commands:")
+		for _, cmd := range globalCmds {
+			fmt.Fprintf(app.ErrOut, "  %s%s    %s\n", cmd.Name, strings.Repeat(" ", padLen-len(cmd.Name)), cmd.Title)
+		}
+	}
+	if len(app.Profiles) > 0 {
+		fmt.Fprintln(app.ErrOut, "Profiles:")
+		for _, profile := range app.Profiles {
+			active := ""
+			if strings.EqualFold(profile, app.Profile) {
+				active = " (active)"
+			}
+			fmt.Fprintf(app.ErrOut, "  %s%s\n", profile, active)
+		}
+	}
+	pad := strings.Repeat(" ", len(app.Me)-1)
 	runfileOpt := ""
-	if config.EnableRunfileOverride {
+	if app.EnableRunfileOverride {
 		runfileOpt = "[-r runfile] "
 	}
-	fmt.Fprintf(config.ErrOut, "Usage:\n")
-	fmt.Fprintf(config.ErrOut, "       %s %shelp <command>\n", config.Me, runfileOpt)
-	fmt.Fprintf(config.ErrOut, "       %s (show help for <command>)\n", pad)
-	fmt.Fprintf(config.ErrOut, "  or   %s %s<command> [option ...]\n", config.Me, runfileOpt)
-	fmt.Fprintf(config.ErrOut, "       %s (run <command>)\n", pad)
+	fmt.Fprintf(app.ErrOut, "Usage:\n")
+	fmt.Fprintf(app.ErrOut, "       %s %shelp <command>\n", app.Me, runfileOpt)
+	fmt.Fprintf(app.ErrOut, "       %s (show help for <command>)\n", pad)
+	fmt.Fprintf(app.ErrOut, "  or   %s %s<command> [option ...]\n", app.Me, runfileOpt)
+	fmt.Fprintf(app.ErrOut, "       %s (run <command>)\n", pad)
 }
 
 // RunHelp shows either the default help or help for the specified command.
 //
-func RunHelp(_ *Runfile) {
+func RunHelp(app *config.App, _ *Runfile, args []string) int {
 	cmdName := "help"
 	// Command?
 	//
-	if len(os.Args) > 0 {
-		cmdName = os.Args[0]
-		os.Args = os.Args[1:]
+	if len(args) > 0 {
+		cmdName = args[0]
 	}
 	cmdName = strings.ToLower(cmdName)
-	if c, ok := config.CommandMap[cmdName]; ok {
+	if c, ok := app.CommandMap[cmdName]; ok {
 		c.Help()
 	} else {
 		log.Printf("command not found: %s", cmdName)
-		ListCommands()
+		if suggestions := SuggestCmds(app, cmdName); len(suggestions) > 0 {
+			showSuggestions(app, suggestions)
+		} else {
+			ListCommands(app)
+		}
 	}
-	os.Exit(2)
+	return 2
 }
 
-// RunCommand executes a command.
+// CmdEnv builds the environment for the command script from its exported variables.
 //
-func RunCommand(cmd *RunCmd) {
-	os.Args = evaluateCmdOpts(cmd, os.Args)
+func CmdEnv(cmd *RunCmd) map[string]string {
 	env := make(map[string]string)
 	for _, name := range cmd.Scope.GetExports() {
 		if value, ok := cmd.Scope.GetVar(name); ok {
@@ -433,6 +483,59 @@ func RunCommand(cmd *RunCmd) {
 			log.Println("Warning: exported variable not defined: ", name)
 		}
 	}
+	return env
+}
+
+// CmdTimeout fetches the timeout for the command, honoring the '--timeout' override.
+//
+func CmdTimeout(app *config.App, cmd *RunCmd) time.Duration {
+	if app.Timeout != nil {
+		return *app.Timeout
+	}
+	return cmd.Config.Timeout
+}
+
+// RunCommand executes a command, returning its exit code.
+// If ctx is cancelled, the command script is terminated.
+//
+func RunCommand(ctx context.Context, app *config.App, cmd *RunCmd, args []string, std *config.Stdio) int {
+	cmd = cmd.Clone()
+	args = evaluateCmdOpts(app, cmd, args)
+	env := CmdEnv(cmd)
 	shell := cmd.Shell()
-	exec.ExecuteCmdScript(shell, cmd.Script, os.Args, env)
+	// Dry run?
+	//
+	if len(app.DryRun) > 0 {
+		d := NewDryRun(app, cmd, shell, args, env)
+		var err error
+		if app.DryRun == config.DryRunJSON {
+			err = d.WriteJSON(std.Out)
+		} else {
+			err = d.WriteText(std.Out)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return 0
+	}
+	// Up to date?
+	//
+	upToDate, sum := checkUpToDate(app, cmd, shell, args, env)
+	if upToDate {
+		fmt.Fprintf(std.Err, "%s: %s: up to date\n", app.Me, cmd.Name)
+		return 0
+	}
+	if err := ConfirmCmd(app, cmd, std); err != nil {
+		log.Printf("%s: %v", cmd.Name, err)
+		return ConfirmAbortCode
+	}
+	opts := exec.Options{Name: cmd.Name, Foreground: true, ForwardSignals: true, KillGrace: app.KillGrace, Timeout: CmdTimeout(app, cmd), Retry: cmd.Config.Retry, ScriptMode: cmd.Config.ScriptMode, Cache: cmd.Config.Cache}
+	code, err := ExecuteCmd(ctx, app, cmd, shell, args, env, std, opts)
+	if err != nil {
+		log.Printf("%s: %v", cmd.Name, err)
+	}
+	if code == 0 && len(sum) > 0 {
+		saveChecksum(cmd, sum)
+	}
+	return code
 }
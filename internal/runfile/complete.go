@@ -0,0 +1,172 @@
+package runfile
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/tekwizely/run/internal/config"
+	"github.com/tekwizely/run/internal/exec"
+)
+
+// NormalizeCompleteScript normalizes a COMPLETE provider script.
+// Removes surrounding whitespace and the optional '$(' ')' wrapper.
+//
+func NormalizeCompleteScript(script string) string {
+	script = strings.TrimSpace(script)
+	if strings.HasPrefix(script, "$(") && strings.HasSuffix(script, ")") {
+		script = strings.TrimSpace(script[2 : len(script)-1])
+	}
+	return script
+}
+
+// RunComplete prints completion candidates for the words of a partially-typed command line.
+// The last word is the one being completed (possibly empty).
+//
+func RunComplete(app *config.App, rf *Runfile, words []string) int {
+	// Command name?
+	//
+	if len(words) <= 1 {
+		prefix := ""
+		if len(words) == 1 {
+			prefix = strings.ToLower(words[0])
+		}
+		for _, cmd := range app.CommandList {
+			if strings.HasPrefix(strings.ToLower(cmd.Name), prefix) {
+				fmt.Println(cmd.Name)
+			}
+		}
+		return 0
+	}
+	if cmd := rf.FindCmd(words[0]); cmd != nil {
+		completeCmd(app, cmd, words[1:len(words)-1], words[len(words)-1])
+	}
+	return 0
+}
+
+// completeCmd prints completion candidates for a runfile command.
+//
+func completeCmd(app *config.App, cmd *RunCmd, prior []string, word string) {
+	// Option value?
+	//
+	var (
+		target string
+		prefix string
+	)
+	if opt := valueOptForWord(cmd, lastWord(prior)); opt != nil {
+		target = opt.Name
+		prior = prior[:len(prior)-1]
+	} else if i := strings.IndexRune(word, '='); i > 0 && strings.HasPrefix(word, "-") {
+		if opt = valueOptForWord(cmd, word[:i]); opt == nil {
+			return
+		}
+		target = opt.Name
+		prefix, word = word[:i+1], word[i+1:]
+	}
+	// Parse the options we already have, ignoring any errors
+	//
+	flags := newCmdFlags(cmd, flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	_ = flags.Parse(prior)
+	// Option names?
+	//
+	if len(target) == 0 && strings.HasPrefix(word, "-") {
+		for _, name := range cmdOptNames(cmd) {
+			if strings.HasPrefix(name, word) {
+				fmt.Println(name)
+			}
+		}
+		return
+	}
+	// Positional argument
+	//
+	if len(target) == 0 {
+		target = "arg" + strconv.Itoa(len(flags.Args())+1)
+	}
+	var complete *RunCmdComplete
+	for _, c := range cmd.Config.Completes {
+		if strings.EqualFold(c.Target, target) {
+			complete = c
+			break
+		}
+	}
+	if complete == nil {
+		return
+	}
+	flags.exportOpts(cmd)
+	env := make(map[string]string)
+	for _, name := range cmd.Scope.GetExports() {
+		if value, ok := cmd.Scope.GetVar(name); ok {
+			env[name] = value
+		}
+	}
+	shell, ok := cmd.Scope.GetAttr(".SHELL")
+	executor := cmd.Executor(shell)
+	if !ok || len(shell) == 0 || shell == "#!" {
+		shell = config.DefaultShell
+		executor = cmd.Scope.GetExecutor(shell)
+	}
+	out := &strings.Builder{}
+	exec.ExecuteCompleteScript(app, shell, cmd.Config.ScriptMode, executor, complete.Script, []string{word}, env, out, config.CompleteTimeout)
+	for _, candidate := range strings.Split(out.String(), "\n") {
+		if len(candidate) > 0 && strings.HasPrefix(candidate, word) {
+			fmt.Println(prefix + candidate)
+		}
+	}
+}
+
+// valueOptForWord returns the value-taking option matching the word (-s | --long), or nil.
+//
+func valueOptForWord(cmd *RunCmd, word string) *RunCmdOpt {
+	// Accept '-' | '--'
+	//
+	name := strings.TrimPrefix(strings.TrimPrefix(word, "-"), "-")
+	if len(name) == 0 || name == word {
+		return nil
+	}
+	for _, opt := range cmd.Config.Opts {
+		if len(opt.Value) == 0 {
+			continue
+		}
+		if (opt.Short != 0 && name == string(opt.Short)) || strings.EqualFold(name, opt.Long) {
+			return opt
+		}
+	}
+	return nil
+}
+
+// cmdOptNames lists the option flags accepted by the command, including -h/--help.
+//
+func cmdOptNames(cmd *RunCmd) []string {
+	var names []string
+	hasHelpShort := false
+	hasHelpLong := false
+	for _, opt := range cmd.Config.Opts {
+		if opt.Short != 0 {
+			hasHelpShort = hasHelpShort || opt.Short == 'h'
+			names = append(names, "-"+string(opt.Short))
+		}
+		if len(opt.Long) > 0 {
+			hasHelpLong = hasHelpLong || strings.EqualFold(opt.Long, "help")
+			names = append(names, "--"+strings.ToLower(opt.Long))
+		}
+	}
+	if !hasHelpShort {
+		names = append(names, "-h")
+	}
+	if !hasHelpLong {
+		names = append(names, "--help")
+	}
+	return names
+}
+
+// lastWord returns the last word of the list, or "" if empty.
+//
+func lastWord(words []string) string {
+	if len(words) == 0 {
+		return ""
+	}
+	return words[len(words)-1]
+}
@@ -0,0 +1,60 @@
+package runfile
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tekwizely/run/internal/config"
+	"github.com/tekwizely/run/internal/term"
+)
+
+// ConfirmAbortCode is returned when a command with a CONFIRM prompt is not confirmed.
+//
+const ConfirmAbortCode = 3
+
+// AssumeYesEnv names the environment variable that, when true, skips CONFIRM prompts (like --yes).
+//
+const AssumeYesEnv = "RUN_ASSUME_YES"
+
+// ErrNotConfirmed is returned (wrapped) when a command with a CONFIRM prompt is not confirmed.
+//
+var ErrNotConfirmed = errors.New("not confirmed")
+
+// confirmMu keeps prompts from commands run in parallel from overlapping.
+//
+var confirmMu sync.Mutex
+
+// ConfirmCmd asks the user to confirm running a command that has a CONFIRM prompt.
+// Returns nil if confirmed, or if the command has no prompt, or if app.AssumeYes (or RUN_ASSUME_YES) is set.
+// Refuses to run the command if stdin is not a terminal.
+//
+func ConfirmCmd(app *config.App, cmd *RunCmd, std *config.Stdio) error {
+	if len(cmd.Config.Confirm) == 0 || app.AssumeYes {
+		return nil
+	}
+	if yes, err := strconv.ParseBool(os.Getenv(AssumeYesEnv)); err == nil && yes {
+		return nil
+	}
+	if f, ok := std.In.(*os.File); !ok || !term.IsTerminal(f) {
+		return fmt.Errorf("%w: stdin is not a terminal: use --yes or %s=1 to skip the prompt", ErrNotConfirmed, AssumeYesEnv)
+	}
+	confirmMu.Lock()
+	defer confirmMu.Unlock()
+	out := std.Err
+	if out == nil {
+		out = ioutil.Discard
+	}
+	fmt.Fprintf(out, "%s [y/N] ", cmd.Config.Confirm)
+	answer, _ := bufio.NewReader(std.In).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer == "y" || answer == "yes" {
+		return nil
+	}
+	return ErrNotConfirmed
+}
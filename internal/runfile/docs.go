@@ -0,0 +1,245 @@
+package runfile
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tekwizely/run/internal/config"
+)
+
+// docUsage is a single formatted usage line.
+// Lines starting with '(' are considered notes about the previous usage.
+//
+type docUsage struct {
+	Text string
+	Note bool
+}
+
+// cmdDocUsages formats the command's usage lines, prefixed with the program and command name.
+//
+func cmdDocUsages(app *config.App, cmd *RunCmd) []docUsage {
+	var usages []docUsage
+	for _, usage := range cmd.Config.Usages {
+		if len(usage) > 0 && usage[0] == '(' {
+			usages = append(usages, docUsage{Text: usage, Note: true})
+		} else {
+			usages = append(usages, docUsage{Text: fmt.Sprintf("%s %s %s", app.Me, cmd.Name, usage)})
+		}
+	}
+	return usages
+}
+
+// docCmds returns the runfile commands, in app.CommandList order.
+//
+func docCmds(app *config.App, rf *Runfile) []*RunCmd {
+	var cmds []*RunCmd
+	for _, c := range app.CommandList {
+		if cmd := rf.FindCmd(c.Name); cmd != nil {
+			cmds = append(cmds, cmd)
+		}
+	}
+	return cmds
+}
+
+// WriteMarkdownDocs renders documentation for every runfile command as Markdown.
+//
+func WriteMarkdownDocs(app *config.App, rf *Runfile, out io.Writer) error {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "# %s\n", mdEscape(app.Me))
+	for _, cmd := range docCmds(app, rf) {
+		fmt.Fprintf(b, "\n## %s\n", mdEscape(cmd.Name))
+		if len(cmd.Config.Desc) > 0 {
+			b.WriteString("\n")
+			for _, desc := range cmd.Config.Desc {
+				fmt.Fprintf(b, "%s  \n", mdEscape(desc))
+			}
+		}
+		if usages := cmdDocUsages(app, cmd); len(usages) > 0 {
+			b.WriteString("\n**Usage:**\n\n```\n")
+			for _, usage := range usages {
+				if usage.Note {
+					b.WriteString("  ")
+				}
+				fmt.Fprintf(b, "%s\n", usage.Text)
+			}
+			b.WriteString("```\n")
+		}
+		if len(cmd.Config.Opts) > 0 {
+			b.WriteString("\n**Options:**\n\n| Option | Description |\n| ------ | ----------- |\n")
+			for _, opt := range cmd.Config.Opts {
+				fmt.Fprintf(b, "| `%s` | %s |\n", opt.Flags(), mdCellEscape(opt.Desc))
+			}
+		}
+	}
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+// mdEscape escapes characters that would otherwise be treated as Markdown formatting.
+//
+func mdEscape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "#", `\#`,
+	).Replace(s)
+}
+
+// mdCellEscape escapes text for use within a Markdown table cell.
+//
+func mdCellEscape(s string) string {
+	return strings.Replace(mdEscape(s), "|", `\|`, -1)
+}
+
+// sourceDateEpochEnv names the environment variable holding the date for generated docs, in seconds since the epoch.
+// See https://reproducible-builds.org/specs/source-date-epoch/
+//
+const sourceDateEpochEnv = "SOURCE_DATE_EPOCH"
+
+// sourceDate returns the date from SOURCE_DATE_EPOCH, or false if not set (or invalid).
+//
+func sourceDate() (time.Time, bool) {
+	epoch, err := strconv.ParseInt(os.Getenv(sourceDateEpochEnv), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(epoch, 0).UTC(), true
+}
+
+// WriteManDocs renders documentation for every runfile command as a roff man page (section 1).
+// The page is only dated if SOURCE_DATE_EPOCH is set, so that the output is reproducible.
+//
+func WriteManDocs(app *config.App, rf *Runfile, out io.Writer) error {
+	b := &strings.Builder{}
+	name := manEscape(app.Me)
+	if date, ok := sourceDate(); ok {
+		fmt.Fprintf(b, ".TH %s 1 \"%s\"\n", strings.ToUpper(name), date.Format("2006-01-02"))
+	} else {
+		fmt.Fprintf(b, ".TH %s 1\n", strings.ToUpper(name))
+	}
+	b.WriteString(".SH NAME\n")
+	fmt.Fprintf(b, "%s \\- run commands\n", name)
+	b.WriteString(".SH SYNOPSIS\n")
+	fmt.Fprintf(b, ".B %s\n.I command\n[option ...]\n", name)
+	b.WriteString(".SH COMMANDS\n")
+	for _, cmd := range docCmds(app, rf) {
+		fmt.Fprintf(b, ".SS %s\n", manEscape(cmd.Name))
+		for _, desc := range cmd.Config.Desc {
+			fmt.Fprintf(b, "%s\n.br\n", manLine(desc))
+		}
+		if usages := cmdDocUsages(app, cmd); len(usages) > 0 {
+			b.WriteString(".PP\n.B Usage:\n.RS\n.nf\n")
+			for _, usage := range usages {
+				if usage.Note {
+					b.WriteString("  ")
+				}
+				fmt.Fprintf(b, "%s\n", manLine(usage.Text))
+			}
+			b.WriteString(".fi\n.RE\n")
+		}
+		if len(cmd.Config.Opts) > 0 {
+			b.WriteString(".PP\n.B Options:\n.RS\n")
+			for _, opt := range cmd.Config.Opts {
+				fmt.Fprintf(b, ".TP\n.B \"%s\"\n%s\n", manEscape(opt.Flags()), manLine(opt.Desc))
+			}
+			b.WriteString(".RE\n")
+		}
+	}
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+// manEscape escapes roff special characters within text.
+//
+func manEscape(s string) string {
+	return strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+}
+
+// manLine escapes a line of text, protecting leading control characters ('.' | '\”).
+//
+func manLine(s string) string {
+	s = manEscape(s)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
+
+// WriteHTMLDocs renders documentation for every runfile command as a standalone HTML page.
+//
+func WriteHTMLDocs(app *config.App, rf *Runfile, out io.Writer) error {
+	b := &strings.Builder{}
+	name := html.EscapeString(app.Me)
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(b, "<title>%s</title>\n</head>\n<body>\n<h1>%s</h1>\n", name, name)
+	for _, cmd := range docCmds(app, rf) {
+		cmdName := html.EscapeString(cmd.Name)
+		fmt.Fprintf(b, "<h2 id=\"%s\">%s</h2>\n", cmdName, cmdName)
+		if len(cmd.Config.Desc) > 0 {
+			b.WriteString("<p>")
+			for i, desc := range cmd.Config.Desc {
+				if i > 0 {
+					b.WriteString("<br>\n")
+				}
+				b.WriteString(html.EscapeString(desc))
+			}
+			b.WriteString("</p>\n")
+		}
+		if usages := cmdDocUsages(app, cmd); len(usages) > 0 {
+			b.WriteString("<h3>Usage</h3>\n<pre>")
+			for _, usage := range usages {
+				if usage.Note {
+					b.WriteString("  ")
+				}
+				fmt.Fprintf(b, "%s\n", html.EscapeString(usage.Text))
+			}
+			b.WriteString("</pre>\n")
+		}
+		if len(cmd.Config.Opts) > 0 {
+			b.WriteString("<h3>Options</h3>\n<table>\n<tr><th>Option</th><th>Description</th></tr>\n")
+			for _, opt := range cmd.Config.Opts {
+				fmt.Fprintf(b, "<tr><td><code>%s</code></td><td>%s</td></tr>\n", html.EscapeString(opt.Flags()), html.EscapeString(opt.Desc))
+			}
+			b.WriteString("</table>\n")
+		}
+	}
+	b.WriteString("</body>\n</html>\n")
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+// RunDocs renders documentation for the runfile commands in the requested --format (default markdown), to std.Out.
+//
+func RunDocs(app *config.App, rf *Runfile, args []string, std *config.Stdio) int {
+	var format string
+	flags := flag.NewFlagSet("docs", flag.ExitOnError)
+	flags.SetOutput(app.ErrOut)
+	flags.Usage = func() {
+		fmt.Fprintf(app.ErrOut, "Usage: %s docs [--format markdown|man|html]\n", app.Me)
+		os.Exit(2)
+	}
+	flags.StringVar(&format, "format", "markdown", "")
+	_ = flags.Parse(args)
+
+	var err error
+	switch strings.ToLower(format) {
+	case "markdown", "md":
+		err = WriteMarkdownDocs(app, rf, std.Out)
+	case "man", "roff":
+		err = WriteManDocs(app, rf, std.Out)
+	case "html":
+		err = WriteHTMLDocs(app, rf, std.Out)
+	default:
+		log.Printf("unknown docs format: %s", format)
+		flags.Usage()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	return 0
+}
@@ -0,0 +1,234 @@
+package runfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/tekwizely/run/internal/config"
+	"github.com/tekwizely/run/internal/exec"
+)
+
+// dryRunScriptFile is shown in place of the temp script file, which is not created during a dry run.
+//
+const dryRunScriptFile = "<script-file>"
+
+// dryRunScript is shown in place of the script, when it is passed as an argument.
+//
+const dryRunScript = "<script>"
+
+// secretMask replaces the value of variables considered secret.
+//
+const secretMask = "********"
+
+// secretNameParts identify variables whose values are masked in dry-run output.
+//
+var secretNameParts = []string{"SECRET", "TOKEN", "PASSWORD", "PASSWD", "PASSPHRASE", "CREDENTIAL", "PRIVATE", "AUTH", "KEY"}
+
+// DryRun captures what would be executed for a command.
+//
+type DryRun struct {
+	Command     string            `json:"command"`
+	Profile     string            `json:"profile,omitempty"`
+	Shell       string            `json:"shell"`
+	ScriptMode  string            `json:"script_mode"`
+	Cache       string            `json:"cache,omitempty"`
+	Timeout     string            `json:"timeout,omitempty"`
+	Retry       string            `json:"retry,omitempty"`
+	Confirm     string            `json:"confirm,omitempty"`
+	Before      []string          `json:"before,omitempty"`
+	After       []string          `json:"after,omitempty"`
+	Finally     []string          `json:"finally,omitempty"`
+	Interpreter []string          `json:"interpreter"`
+	Script      []string          `json:"script"`
+	Args        []string          `json:"args"`
+	Overrides   map[string]string `json:"overrides,omitempty"`
+	Env         map[string]string `json:"env"`
+}
+
+// NewDryRun captures the resolved script and environment for a command.
+// Values of secret-looking variables are masked unless app.ShowSecrets is set.
+//
+func NewDryRun(app *config.App, cmd *RunCmd, shell string, args []string, env map[string]string) *DryRun {
+	executor := cmd.Executor(shell)
+	mode := exec.ResolveScriptMode(executor, cmd.Config.ScriptMode, cmd.Script)
+	script := dryRunScriptFile
+	if mode == exec.ScriptModeArg {
+		script = dryRunScript
+	}
+	// Cached scripts are run from a known location
+	//
+	var cacheEntry string
+	if cmd.Config.Cache && shell == "#!" {
+		if entry, file, err := exec.CachedScriptPath(executor, strings.Join(cmd.Script, "")); err == nil {
+			cacheEntry, script = entry, file
+			env = withEnvVar(env, exec.CacheEntryVar, entry)
+		}
+	}
+	d := &DryRun{
+		Command:     cmd.Name,
+		Profile:     app.Profile,
+		Shell:       shell,
+		ScriptMode:  mode,
+		Cache:       cacheEntry,
+		Interpreter: exec.CommandLine(executor, mode, cmd.Name, script, args),
+		Script:      []string{},
+		Confirm:     cmd.Config.Confirm,
+		Args:        append([]string{}, args...),
+		Env:         make(map[string]string),
+	}
+	if timeout := CmdTimeout(app, cmd); timeout > 0 {
+		d.Timeout = timeout.String()
+	}
+	if cmd.Config.Retry != nil {
+		d.Retry = cmd.Config.Retry.String()
+	}
+	if cmd.Hooks != nil {
+		d.Before = HookNames(cmd.Hooks.Before)
+		d.After = HookNames(cmd.Hooks.After)
+		d.Finally = HookNames(cmd.Hooks.Finally)
+	}
+	for _, line := range cmd.Script {
+		d.Script = append(d.Script, strings.TrimRight(line, "\n"))
+	}
+	for name, value := range executor.Environ(env) {
+		d.Env[name] = maskSecret(app, name, value)
+	}
+	if len(app.CLIVars) > 0 && CLIVarsEnabled(cmd.Scope) {
+		d.Overrides = make(map[string]string, len(app.CLIVars))
+		for name, value := range app.CLIVars {
+			d.Overrides[name] = maskSecret(app, name, value)
+		}
+	}
+	return d
+}
+
+// withEnvVar returns a copy of env, with the variable set.
+//
+func withEnvVar(env map[string]string, name string, value string) map[string]string {
+	c := make(map[string]string, len(env)+1)
+	for k, v := range env {
+		c[k] = v
+	}
+	c[name] = value
+	return c
+}
+
+// writeVars writes the variables as indented 'NAME=value' lines, sorted by name.
+//
+func writeVars(b *strings.Builder, vars map[string]string) {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(b, "  %s=%s\n", name, vars[name])
+	}
+}
+
+// maskSecret masks the value of a secret-looking variable, unless app.ShowSecrets is set.
+//
+func maskSecret(app *config.App, name string, value string) string {
+	if !app.ShowSecrets && len(value) > 0 && isSecretName(name) {
+		return secretMask
+	}
+	return value
+}
+
+// isSecretName returns true if the variable name looks like it holds a secret.
+//
+func isSecretName(name string) bool {
+	name = strings.ToUpper(name)
+	for _, part := range secretNameParts {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteText writes the dry run in human-readable form.
+//
+func (d *DryRun) WriteText(out io.Writer) error {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "Command: %s\n", d.Command)
+	if len(d.Profile) > 0 {
+		fmt.Fprintf(b, "Profile: %s\n", d.Profile)
+	}
+	fmt.Fprintf(b, "Shell: %s\n", d.Shell)
+	fmt.Fprintf(b, "Script Mode: %s\n", d.ScriptMode)
+	if len(d.Cache) > 0 {
+		fmt.Fprintf(b, "Cache: %s\n", d.Cache)
+	}
+	if len(d.Timeout) > 0 {
+		fmt.Fprintf(b, "Timeout: %s\n", d.Timeout)
+	}
+	if len(d.Retry) > 0 {
+		fmt.Fprintf(b, "Retry: %s\n", d.Retry)
+	}
+	if len(d.Confirm) > 0 {
+		fmt.Fprintf(b, "Confirm: %s\n", d.Confirm)
+	}
+	for _, hooks := range []struct {
+		label string
+		names []string
+	}{{"Before", d.Before}, {"After", d.After}, {"Finally", d.Finally}} {
+		if len(hooks.names) > 0 {
+			fmt.Fprintf(b, "%s: %s\n", hooks.label, strings.Join(hooks.names, " "))
+		}
+	}
+	interpreter := make([]string, len(d.Interpreter))
+	for i, arg := range d.Interpreter {
+		interpreter[i] = shellQuote(arg)
+	}
+	fmt.Fprintf(b, "Interpreter:\n  %s\n", strings.Join(interpreter, " "))
+	b.WriteString("Args:\n")
+	for i, arg := range d.Args {
+		fmt.Fprintf(b, "  $%d = %q\n", i+1, arg)
+	}
+	if len(d.Overrides) > 0 {
+		b.WriteString("Overrides:\n")
+		writeVars(b, d.Overrides)
+	}
+	b.WriteString("Environment:\n")
+	writeVars(b, d.Env)
+	b.WriteString("Script:\n")
+	for _, line := range d.Script {
+		fmt.Fprintf(b, "  %s\n", line)
+	}
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+// WriteJSON writes the dry run as JSON.
+//
+func (d *DryRun) WriteJSON(out io.Writer) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(d)
+}
+
+// shellQuote single-quotes an argument for display, if it contains any shell-special characters.
+//
+func shellQuote(arg string) string {
+	if len(arg) > 0 && strings.IndexFunc(arg, isShellSpecial) < 0 {
+		return arg
+	}
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
+
+// isShellSpecial returns true if the rune needs quoting within a shell word.
+//
+func isShellSpecial(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return false
+	case strings.ContainsRune("_-+=/.,:@%<>", r):
+		return false
+	}
+	return true
+}
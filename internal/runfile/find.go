@@ -0,0 +1,37 @@
+package runfile
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// repoMarkers identify the root of a repository, where the search for a runfile stops.
+//
+var repoMarkers = []string{".git", ".hg", ".svn"}
+
+// Find searches for the named runfile, starting in dir and walking up through its parents.
+// The search stops at the root of a repository, or when crossing onto a different filesystem.
+// Returns the absolute path of the nearest runfile, or false if none found.
+//
+func Find(dir string, name string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	for {
+		file := filepath.Join(dir, name)
+		if stat, err := os.Stat(file); err == nil && stat.Mode().IsRegular() {
+			return file, true
+		}
+		for _, marker := range repoMarkers {
+			if _, err := os.Stat(filepath.Join(dir, marker)); err == nil {
+				return "", false
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir || !sameFilesystem(dir, parent) {
+			return "", false
+		}
+		dir = parent
+	}
+}
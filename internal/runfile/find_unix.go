@@ -0,0 +1,22 @@
+//go:build !windows
+// +build !windows
+
+package runfile
+
+import (
+	"os"
+	"syscall"
+)
+
+// sameFilesystem returns true if both directories reside on the same device.
+//
+func sameFilesystem(a string, b string) bool {
+	statA, errA := os.Stat(a)
+	statB, errB := os.Stat(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	sysA, okA := statA.Sys().(*syscall.Stat_t)
+	sysB, okB := statB.Sys().(*syscall.Stat_t)
+	return okA && okB && sysA.Dev == sysB.Dev
+}
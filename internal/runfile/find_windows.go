@@ -0,0 +1,9 @@
+package runfile
+
+import "path/filepath"
+
+// sameFilesystem returns true if both directories reside on the same volume.
+//
+func sameFilesystem(a string, b string) bool {
+	return filepath.VolumeName(a) == filepath.VolumeName(b)
+}
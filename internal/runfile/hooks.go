@@ -0,0 +1,158 @@
+package runfile
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/tekwizely/run/internal/config"
+	"github.com/tekwizely/run/internal/exec"
+)
+
+// Variables exported to hook scripts.
+//
+const (
+	HookCmdVar      = "RUN_CMD"       // Name of the command being run
+	HookArgsVar     = "RUN_ARGS"      // Arguments of the command being run (shell-quoted)
+	HookExitCodeVar = "RUN_EXIT_CODE" // Exit code of the command (AFTER / FINALLY hooks only)
+)
+
+// Hook phases, named as their attributes.
+//
+const (
+	HookBefore  = "BEFORE"
+	HookAfter   = "AFTER"
+	HookFinally = "FINALLY"
+)
+
+// RunCmdHooks captures the commands run around a command's script, in the order they run.
+//
+type RunCmdHooks struct {
+	Before  []*RunCmd
+	After   []*RunCmd
+	Finally []*RunCmd
+}
+
+// ResolveHooks resolves the hooks of each command, from its BEFORE / AFTER / FINALLY attributes
+// and the global .BEFORE / .AFTER / .FINALLY attributes.
+// Global before-hooks run ahead of the command's own, while global after-hooks run behind them.
+// A command is never run as a global hook of itself.
+// Panics if a hook names an unknown command.
+//
+func (r *Runfile) ResolveHooks() {
+	for _, cmd := range r.Cmds {
+		cmd.Hooks = &RunCmdHooks{
+			Before:  append(r.globalHooks(cmd, HookBefore), r.findHooks(cmd, HookBefore, cmd.Config.Before)...),
+			After:   append(r.findHooks(cmd, HookAfter, cmd.Config.After), r.globalHooks(cmd, HookAfter)...),
+			Finally: append(r.findHooks(cmd, HookFinally, cmd.Config.Finally), r.globalHooks(cmd, HookFinally)...),
+		}
+	}
+}
+
+// globalHooks resolves the hooks named by the global attribute for the phase, as seen by the command.
+//
+func (r *Runfile) globalHooks(cmd *RunCmd, phase string) []*RunCmd {
+	value, _ := cmd.Scope.GetAttr("." + phase)
+	var hooks []*RunCmd
+	for _, hook := range r.findHooks(cmd, "."+phase, strings.Fields(value)) {
+		if hook != cmd {
+			hooks = append(hooks, hook)
+		}
+	}
+	return hooks
+}
+
+// findHooks resolves hook names to commands.
+//
+func (r *Runfile) findHooks(cmd *RunCmd, attr string, names []string) []*RunCmd {
+	var hooks []*RunCmd
+	for _, name := range names {
+		hook := r.FindCmd(name)
+		if hook == nil {
+			panic(fmt.Sprintf("%s: %s: command not found: %s", cmd.Name, attr, name))
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks
+}
+
+// HookNames returns the names of the hooks, i.e. for display.
+//
+func HookNames(hooks []*RunCmd) []string {
+	names := make([]string, len(hooks))
+	for i, hook := range hooks {
+		names[i] = hook.Name
+	}
+	return names
+}
+
+// ExecuteCmd executes a command script, surrounded by the command's hooks.
+// The script is skipped if a BEFORE hook fails, and AFTER hooks only run if the script succeeds.
+// FINALLY hooks always run, even if ctx is cancelled.
+// Returns the first non-zero exit code, along with the first error.
+//
+func ExecuteCmd(ctx context.Context, app *config.App, cmd *RunCmd, shell string, args []string, env map[string]string, std *config.Stdio, opts exec.Options) (int, error) {
+	opts.Executor = cmd.Executor(shell)
+	hooks := cmd.Hooks
+	if hooks == nil {
+		return exec.ExecuteCmdScript(ctx, app, shell, cmd.Script, args, env, std, opts)
+	}
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	hookEnv := map[string]string{HookCmdVar: cmd.Name, HookArgsVar: strings.Join(quoted, " ")}
+
+	code, err := executeHooks(ctx, app, HookBefore, hooks.Before, hookEnv, std, opts)
+	if code == 0 && err == nil {
+		code, err = exec.ExecuteCmdScript(ctx, app, shell, cmd.Script, args, env, std, opts)
+		if code == 0 && err == nil {
+			hookEnv[HookExitCodeVar] = "0"
+			code, err = executeHooks(ctx, app, HookAfter, hooks.After, hookEnv, std, opts)
+		}
+	}
+	hookEnv[HookExitCodeVar] = strconv.Itoa(code)
+	if ctx.Err() != nil {
+		ctx = context.Background()
+	}
+	finallyCode, finallyErr := executeHooks(ctx, app, HookFinally, hooks.Finally, hookEnv, std, opts)
+	if code == 0 {
+		code = finallyCode
+	}
+	if err == nil {
+		err = finallyErr
+	}
+	return code, err
+}
+
+// executeHooks executes the hook scripts in order, stopping at the first failure (which is reported).
+//
+func executeHooks(ctx context.Context, app *config.App, phase string, hooks []*RunCmd, hookEnv map[string]string, std *config.Stdio, opts exec.Options) (int, error) {
+	for _, hook := range hooks {
+		env := CmdEnv(hook)
+		for k, v := range hookEnv {
+			env[k] = v
+		}
+		opts.Name = hook.Name
+		opts.Timeout = CmdTimeout(app, hook)
+		opts.Retry = hook.Config.Retry
+		opts.ScriptMode = hook.Config.ScriptMode
+		opts.Cache = hook.Config.Cache
+		opts.Executor = hook.Executor(hook.Shell())
+		code, err := exec.ExecuteCmdScript(ctx, app, hook.Shell(), hook.Script, []string{}, env, std, opts)
+		if err != nil {
+			return code, fmt.Errorf("%s hook %s: %w", phase, hook.Name, err)
+		}
+		if code != 0 {
+			errOut := std.Err
+			if errOut == nil {
+				errOut = ioutil.Discard
+			}
+			fmt.Fprintf(errOut, "%s: %s: %s hook %s exited with code %d\n", app.Me, hookEnv[HookCmdVar], phase, hook.Name, code)
+			return code, nil
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,202 @@
+package runfile
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/tekwizely/run/internal/config"
+)
+
+// ListSchemaVersion is the version of the machine-readable command listing.
+// Bump it whenever a field is removed or changes meaning.
+//
+const ListSchemaVersion = 1
+
+// CmdListing is the machine-readable command listing.
+//
+type CmdListing struct {
+	SchemaVersion int        `json:"schema_version"`
+	Commands      []*CmdInfo `json:"commands"`
+}
+
+// CmdInfo describes a single command in the listing.
+//
+type CmdInfo struct {
+	Name    string        `json:"name"`
+	Title   string        `json:"title"`
+	Desc    []string      `json:"description"`
+	Usages  []string      `json:"usages"`
+	Opts    []*CmdOptInfo `json:"options"`
+	Shell   string        `json:"shell"`
+	Exports []string      `json:"exports"`
+	Builtin bool          `json:"builtin"`
+	Global  bool          `json:"global"`
+}
+
+// CmdOptInfo describes a single command option in the listing.
+//
+type CmdOptInfo struct {
+	Name  string `json:"name"`
+	Short string `json:"short"`
+	Long  string `json:"long"`
+	Value string `json:"value_name"`
+	Desc  string `json:"description"`
+}
+
+// NewCmdListing builds the listing of all commands in app.CommandList.
+//
+func NewCmdListing(app *config.App, rf *Runfile) *CmdListing {
+	listing := &CmdListing{SchemaVersion: ListSchemaVersion, Commands: []*CmdInfo{}}
+	for _, c := range app.CommandList {
+		info := &CmdInfo{
+			Name:    c.Name,
+			Title:   c.Title,
+			Desc:    []string{},
+			Usages:  []string{},
+			Opts:    []*CmdOptInfo{},
+			Exports: []string{},
+			Builtin: true,
+		}
+		if cmd := rf.FindCmd(c.Name); cmd != nil {
+			info.Builtin = false
+			info.Global = cmd.Global
+			info.Shell = cmd.Shell()
+			info.Desc = append(info.Desc, cmd.Config.Desc...)
+			info.Usages = append(info.Usages, cmd.Config.Usages...)
+			for _, opt := range cmd.Config.Opts {
+				optInfo := &CmdOptInfo{Name: opt.Name, Long: opt.Long, Value: opt.Value, Desc: opt.Desc}
+				if opt.Short != 0 {
+					optInfo.Short = string(opt.Short)
+				}
+				info.Opts = append(info.Opts, optInfo)
+			}
+			seen := make(map[string]bool)
+			for _, name := range cmd.Scope.GetExports() {
+				if !seen[name] {
+					seen[name] = true
+					info.Exports = append(info.Exports, name)
+				}
+			}
+		}
+		listing.Commands = append(listing.Commands, info)
+	}
+	return listing
+}
+
+// WriteJSON writes the listing as JSON.
+//
+func (l *CmdListing) WriteJSON(out io.Writer) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(l)
+}
+
+// WriteYAML writes the listing as YAML.
+// Strings are always double-quoted, so no escaping rules beyond Go's quoting apply.
+//
+func (l *CmdListing) WriteYAML(out io.Writer) error {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "schema_version: %d\n", l.SchemaVersion)
+	if len(l.Commands) == 0 {
+		b.WriteString("commands: []\n")
+	} else {
+		b.WriteString("commands:\n")
+	}
+	for _, cmd := range l.Commands {
+		fmt.Fprintf(b, "  - name: %s\n", strconv.Quote(cmd.Name))
+		fmt.Fprintf(b, "    title: %s\n", strconv.Quote(cmd.Title))
+		writeYAMLList(b, "    ", "description", cmd.Desc)
+		writeYAMLList(b, "    ", "usages", cmd.Usages)
+		if len(cmd.Opts) == 0 {
+			b.WriteString("    options: []\n")
+		} else {
+			b.WriteString("    options:\n")
+		}
+		for _, opt := range cmd.Opts {
+			fmt.Fprintf(b, "      - name: %s\n", strconv.Quote(opt.Name))
+			fmt.Fprintf(b, "        short: %s\n", strconv.Quote(opt.Short))
+			fmt.Fprintf(b, "        long: %s\n", strconv.Quote(opt.Long))
+			fmt.Fprintf(b, "        value_name: %s\n", strconv.Quote(opt.Value))
+			fmt.Fprintf(b, "        description: %s\n", strconv.Quote(opt.Desc))
+		}
+		fmt.Fprintf(b, "    shell: %s\n", strconv.Quote(cmd.Shell))
+		writeYAMLList(b, "    ", "exports", cmd.Exports)
+		fmt.Fprintf(b, "    builtin: %t\n", cmd.Builtin)
+		fmt.Fprintf(b, "    global: %t\n", cmd.Global)
+	}
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+// writeYAMLList writes a list of strings as a YAML sequence.
+//
+func writeYAMLList(b *strings.Builder, indent string, key string, values []string) {
+	if len(values) == 0 {
+		fmt.Fprintf(b, "%s%s: []\n", indent, key)
+		return
+	}
+	fmt.Fprintf(b, "%s%s:\n", indent, key)
+	for _, value := range values {
+		fmt.Fprintf(b, "%s  - %s\n", indent, strconv.Quote(value))
+	}
+}
+
+// WriteTSV writes the listing as tab-separated values, one command per line, with a header line.
+// Only single-value fields are included.
+//
+func (l *CmdListing) WriteTSV(out io.Writer) error {
+	b := &strings.Builder{}
+	b.WriteString("name\ttitle\tshell\tbuiltin\tglobal\n")
+	for _, cmd := range l.Commands {
+		fmt.Fprintf(b, "%s\t%s\t%s\t%t\t%t\n", tsvField(cmd.Name), tsvField(cmd.Title), tsvField(cmd.Shell), cmd.Builtin, cmd.Global)
+	}
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+// tsvField replaces tabs and newlines, which cannot appear in a TSV field.
+//
+func tsvField(s string) string {
+	return strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(s)
+}
+
+// RunList lists the commands, either as help text or in the requested --format (written to std.Out).
+//
+func RunList(app *config.App, rf *Runfile, args []string, std *config.Stdio) int {
+	var format string
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	flags.SetOutput(app.ErrOut)
+	flags.Usage = func() {
+		fmt.Fprintf(app.ErrOut, "Usage: %s list [--format json|yaml|tsv]\n", app.Me)
+		os.Exit(2)
+	}
+	flags.StringVar(&format, "format", "", "")
+	_ = flags.Parse(args)
+
+	listing := NewCmdListing(app, rf)
+	var err error
+	switch strings.ToLower(format) {
+	case "":
+		ListCommands(app)
+		return 0
+	case "json":
+		err = listing.WriteJSON(std.Out)
+	case "yaml", "yml":
+		err = listing.WriteYAML(std.Out)
+	case "tsv":
+		err = listing.WriteTSV(std.Out)
+	default:
+		log.Printf("unknown list format: %s", format)
+		flags.Usage()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	return 0
+}
@@ -0,0 +1,153 @@
+package runfile
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tekwizely/run/internal/config"
+)
+
+// Invocation captures a command to run, along with its arguments.
+//
+type Invocation struct {
+	Cmd  *config.Command
+	Args []string
+}
+
+// invocationResult captures the outcome of an invocation.
+//
+type invocationResult struct {
+	name     string
+	code     int
+	duration time.Duration
+}
+
+// RunSequential runs the commands in order, stopping at the first failure.
+// Returns the exit code of the failed command, or 0.
+//
+func RunSequential(ctx context.Context, app *config.App, invocations []*Invocation, std *config.Stdio) int {
+	checkInvocations(invocations)
+	for _, inv := range invocations {
+		if code := inv.Cmd.Run(ctx, inv.Args, std); code != 0 {
+			return code
+		}
+	}
+	return 0
+}
+
+// checkInvocations validates the arguments of every command before any are run,
+// so that a bad option exits before, rather than part way through, the run.
+//
+func checkInvocations(invocations []*Invocation) {
+	for _, inv := range invocations {
+		if inv.Cmd.Check != nil {
+			inv.Cmd.Check(inv.Args)
+		}
+	}
+}
+
+// RunParallel runs the commands concurrently, with at most jobs running at a time.
+// Output lines are prefixed with the command name, and a summary is shown once all commands complete.
+// Returns the exit code of the first failed command (in invocation order), or 0.
+//
+func RunParallel(ctx context.Context, app *config.App, invocations []*Invocation, jobs int, std *config.Stdio) int {
+	checkInvocations(invocations)
+	if jobs < 1 {
+		jobs = len(invocations)
+	}
+	padLen := 0
+	for _, inv := range invocations {
+		if len(inv.Cmd.Name) > padLen {
+			padLen = len(inv.Cmd.Name)
+		}
+	}
+	var (
+		mu      sync.Mutex // Guards writes to std.Out + std.Err
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, jobs)
+		results = make([]*invocationResult, len(invocations))
+	)
+	for i, inv := range invocations {
+		wg.Add(1)
+		go func(i int, inv *Invocation) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			prefix := fmt.Sprintf("%s%s | ", inv.Cmd.Name, strings.Repeat(" ", padLen-len(inv.Cmd.Name)))
+			out := &prefixWriter{mu: &mu, out: std.Out, prefix: prefix}
+			errOut := &prefixWriter{mu: &mu, out: std.Err, prefix: prefix}
+			// Parallel commands do not share stdin
+			//
+			cmdStd := &config.Stdio{In: nil, Out: out, Err: errOut}
+			start := time.Now()
+			code := inv.Cmd.Run(ctx, inv.Args, cmdStd)
+			results[i] = &invocationResult{name: inv.Cmd.Name, code: code, duration: time.Since(start)}
+			out.Flush()
+			errOut.Flush()
+		}(i, inv)
+	}
+	wg.Wait()
+	// Summary
+	//
+	fmt.Fprintln(app.ErrOut, "Summary:")
+	w := tabwriter.NewWriter(app.ErrOut, 0, 0, 4, ' ', 0)
+	fmt.Fprintln(w, "  COMMAND\tEXIT\tDURATION")
+	result := 0
+	for _, r := range results {
+		fmt.Fprintf(w, "  %s\t%d\t%s\n", r.name, r.code, r.duration.Round(time.Millisecond))
+		if r.code != 0 && result == 0 {
+			result = r.code
+		}
+	}
+	_ = w.Flush()
+	return result
+}
+
+// prefixWriter writes complete lines, each prefixed, to the underlying writer.
+// Partial lines are buffered until complete or flushed.
+//
+type prefixWriter struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	prefix string
+	buf    []byte
+}
+
+// Write implements io.Writer.
+//
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.writeLine(w.buf[:i+1])
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes any buffered partial line, terminating it with a newline.
+//
+func (w *prefixWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.writeLine(append(w.buf, '\n'))
+		w.buf = nil
+	}
+}
+
+// writeLine writes a single prefixed line.
+//
+func (w *prefixWriter) writeLine(line []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, _ = io.WriteString(w.out, w.prefix)
+	_, _ = w.out.Write(line)
+}
@@ -0,0 +1,442 @@
+package runfile
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tekwizely/run/internal/config"
+	"github.com/tekwizely/run/internal/term"
+)
+
+// PickCommand is the .DEFAULT value that shows the interactive command picker.
+//
+const PickCommand = "@pick"
+
+// pickMaxItems limits how many commands the picker shows at once.
+//
+const pickMaxItems = 10
+
+// pickPreviewLines limits how many description lines the picker previews.
+//
+const pickPreviewLines = 3
+
+// pickCanceledCode is the exit code when the user cancels the picker.
+//
+const pickCanceledCode = 130
+
+// errPickCanceled is returned when the user cancels the picker.
+//
+var errPickCanceled = errors.New("canceled")
+
+// Terminal escape sequences
+//
+const (
+	ansiClearLine  = "\x1b[K"
+	ansiClearBelow = "\x1b[J"
+	ansiReverse    = "\x1b[7m"
+	ansiDim        = "\x1b[2m"
+	ansiReset      = "\x1b[0m"
+	ansiHideCursor = "\x1b[?25l"
+	ansiShowCursor = "\x1b[?25h"
+)
+
+// Key codes
+//
+const (
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyBackspace = 8
+	keyLF        = 10
+	keyCR        = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// RunPicker lets the user choose a command, then prompts for its options and arguments before running it.
+// Shows a filterable menu when stdin and stderr are terminals, otherwise falls back to a numbered prompt.
+// Returns the command's exit code.
+//
+func RunPicker(ctx context.Context, app *config.App, rf *Runfile, std *config.Stdio) int {
+	var cmds []*config.Command
+	for _, c := range app.CommandList {
+		if !c.Builtin {
+			cmds = append(cmds, c)
+		}
+	}
+	if len(cmds) == 0 {
+		log.Printf("no commands to pick from")
+		return 2
+	}
+	var (
+		cmd *config.Command
+		err error
+	)
+	var input io.Reader = os.Stdin
+	if term.IsTerminal(os.Stdin) && term.IsTerminal(os.Stderr) {
+		fd := int(os.Stdin.Fd())
+		if state, rawErr := term.MakeRaw(fd); rawErr == nil {
+			var rest []byte
+			cmd, rest, err = pickMenu(app, rf, cmds)
+			_ = term.Restore(fd, state)
+			// Keep any input typed ahead of the prompts
+			//
+			input = io.MultiReader(bytes.NewReader(rest), os.Stdin)
+		}
+	}
+	in := bufio.NewReader(input)
+	if cmd == nil && err == nil {
+		cmd, err = pickNumbered(app, cmds, in)
+	}
+	var args []string
+	if err == nil {
+		if rfcmd := rf.FindCmd(cmd.Name); rfcmd != nil {
+			args, err = promptCmdArgs(app, rfcmd, in)
+		}
+	}
+	switch {
+	case err == io.EOF:
+		fmt.Fprintln(app.ErrOut)
+		fallthrough
+	case err == errPickCanceled:
+		log.Printf("%v", errPickCanceled)
+		return pickCanceledCode
+	case err != nil:
+		log.Printf("%v", err)
+		return 2
+	}
+	// Show the equivalent command line
+	//
+	line := []string{app.Me, cmd.Name}
+	for _, arg := range args {
+		line = append(line, shellQuote(arg))
+	}
+	fmt.Fprintf(app.ErrOut, "%s\n", strings.Join(line, " "))
+	return cmd.Run(ctx, args, std)
+}
+
+// pickMenuState tracks the picker menu.
+//
+type pickMenuState struct {
+	rf       *Runfile
+	cmds     []*config.Command
+	filter   []rune
+	matches  []*config.Command
+	selected int
+	padLen   int
+	width    int
+	lines    int // Lines drawn, so they can be redrawn
+}
+
+// pickMenu shows a filterable menu of commands.  The terminal must already be in raw mode.
+// Also returns any input read after the selection.
+//
+func pickMenu(app *config.App, rf *Runfile, cmds []*config.Command) (*config.Command, []byte, error) {
+	m := &pickMenuState{rf: rf, cmds: cmds, width: 80}
+	if width, err := term.Width(int(os.Stderr.Fd())); err == nil && width > 0 {
+		m.width = width
+	}
+	for _, c := range cmds {
+		if len(c.Name) > m.padLen {
+			m.padLen = len(c.Name)
+		}
+	}
+	m.update()
+	fmt.Fprint(app.ErrOut, ansiHideCursor)
+	defer fmt.Fprint(app.ErrOut, ansiShowCursor)
+	buf := make([]byte, 256)
+	for {
+		m.draw(app.ErrOut)
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			m.clear(app.ErrOut)
+			return nil, nil, err
+		}
+		// Lone escape = cancel
+		//
+		if n == 1 && buf[0] == keyEscape {
+			m.clear(app.ErrOut)
+			return nil, nil, errPickCanceled
+		}
+		// Input may contain several keys (i.e. when pasted)
+		//
+		for input := buf[:n]; len(input) > 0; {
+			size := 1
+			switch key := input[0]; {
+			case key == keyCtrlC || key == keyCtrlD:
+				m.clear(app.ErrOut)
+				return nil, nil, errPickCanceled
+			case key == keyCR || key == keyLF:
+				if len(m.matches) > 0 {
+					m.clear(app.ErrOut)
+					return m.matches[m.selected], append([]byte{}, input[1:]...), nil
+				}
+			case key == keyEscape:
+				// Arrow keys: ESC [ A | ESC O A
+				//
+				if len(input) >= 3 && (input[1] == '[' || input[1] == 'O') {
+					size = 3
+					m.move(input[2])
+				}
+			case key == keyBackspace || key == keyDelete:
+				if len(m.filter) > 0 {
+					m.filter = m.filter[:len(m.filter)-1]
+					m.update()
+				}
+			case key == keyCtrlU:
+				m.filter = nil
+				m.update()
+			case key == keyCtrlP:
+				m.move('A')
+			case key == keyCtrlN:
+				m.move('B')
+			case key >= ' ':
+				var r rune
+				if r, size = utf8.DecodeRune(input); r != utf8.RuneError {
+					m.filter = append(m.filter, r)
+					m.update()
+				}
+			}
+			input = input[size:]
+		}
+	}
+}
+
+// move moves the selection up ('A') or down ('B').
+//
+func (m *pickMenuState) move(dir byte) {
+	switch {
+	case dir == 'A' && m.selected > 0:
+		m.selected--
+	case dir == 'B' && m.selected < len(m.matches)-1:
+		m.selected++
+	}
+}
+
+// update applies the filter to the commands, matching (case-insensitive) on name or title.
+//
+func (m *pickMenuState) update() {
+	filter := strings.ToLower(string(m.filter))
+	m.matches = nil
+	for _, c := range m.cmds {
+		if strings.Contains(strings.ToLower(c.Name), filter) || strings.Contains(strings.ToLower(c.Title), filter) {
+			m.matches = append(m.matches, c)
+		}
+	}
+	if m.selected >= len(m.matches) {
+		m.selected = len(m.matches) - 1
+	}
+	if m.selected < 0 {
+		m.selected = 0
+	}
+}
+
+// draw (re)draws the menu, leaving the cursor below it.
+//
+func (m *pickMenuState) draw(out io.Writer) {
+	var lines []string
+	lines = append(lines, m.truncate("Pick a command (type to filter, up/down to select, enter to run, ctrl-c to cancel)"))
+	lines = append(lines, m.truncate("> "+string(m.filter)))
+	start := 0
+	if m.selected >= pickMaxItems {
+		start = m.selected - pickMaxItems + 1
+	}
+	for i := start; i < len(m.matches) && i < start+pickMaxItems; i++ {
+		c := m.matches[i]
+		line := m.truncate(fmt.Sprintf("  %s%s    %s", c.Name, strings.Repeat(" ", m.padLen-len(c.Name)), c.Title))
+		if i == m.selected {
+			line = ansiReverse + line + ansiReset
+		}
+		lines = append(lines, line)
+	}
+	if len(m.matches) == 0 {
+		lines = append(lines, "  (no matching commands)")
+	} else if cmd := m.rf.FindCmd(m.matches[m.selected].Name); cmd != nil {
+		// Preview
+		//
+		for i := 1; i < len(cmd.Config.Desc) && i <= pickPreviewLines; i++ {
+			lines = append(lines, ansiDim+m.truncate("    "+cmd.Config.Desc[i])+ansiReset)
+		}
+	}
+	b := &strings.Builder{}
+	m.moveToTop(b)
+	for _, line := range lines {
+		b.WriteString(line + ansiClearLine + "\n")
+	}
+	m.lines = len(lines)
+	_, _ = io.WriteString(out, b.String())
+}
+
+// clear erases the menu.
+//
+func (m *pickMenuState) clear(out io.Writer) {
+	b := &strings.Builder{}
+	m.moveToTop(b)
+	m.lines = 0
+	_, _ = io.WriteString(out, b.String())
+}
+
+// moveToTop moves the cursor to the first line of the menu, clearing everything below.
+//
+func (m *pickMenuState) moveToTop(b *strings.Builder) {
+	if m.lines > 0 {
+		fmt.Fprintf(b, "\x1b[%dA", m.lines)
+	}
+	b.WriteString("\r" + ansiClearBelow)
+}
+
+// truncate shortens the line to fit the terminal width, so it does not wrap.
+//
+func (m *pickMenuState) truncate(line string) string {
+	if utf8.RuneCountInString(line) < m.width {
+		return line
+	}
+	return string([]rune(line)[:m.width-1])
+}
+
+// pickNumbered shows a numbered list of commands, prompting for a number (or name).
+//
+func pickNumbered(app *config.App, cmds []*config.Command, in *bufio.Reader) (*config.Command, error) {
+	padLen := 0
+	for _, c := range cmds {
+		if len(c.Name) > padLen {
+			padLen = len(c.Name)
+		}
+	}
+	numLen := len(strconv.Itoa(len(cmds)))
+	fmt.Fprintln(app.ErrOut, "Commands:")
+	for i, c := range cmds {
+		fmt.Fprintf(app.ErrOut, "  %*d) %s%s    %s\n", numLen, i+1, c.Name, strings.Repeat(" ", padLen-len(c.Name)), c.Title)
+	}
+	for {
+		fmt.Fprintf(app.ErrOut, "Select a command [1-%d]: ", len(cmds))
+		line, err := readLine(in)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := strconv.Atoi(line); err == nil && n >= 1 && n <= len(cmds) {
+			return cmds[n-1], nil
+		}
+		for _, c := range cmds {
+			if strings.EqualFold(c.Name, line) {
+				return c, nil
+			}
+		}
+		fmt.Fprintf(app.ErrOut, "Invalid selection: %s\n", line)
+	}
+}
+
+// promptCmdArgs prompts for the command's options and arguments.
+//
+func promptCmdArgs(app *config.App, cmd *RunCmd, in *bufio.Reader) ([]string, error) {
+	var args []string
+	for _, opt := range cmd.Config.Opts {
+		name := "--" + strings.ToLower(opt.Long)
+		if len(opt.Long) == 0 {
+			name = "-" + string(opt.Short)
+		}
+		label := opt.Flags()
+		if len(opt.Desc) > 0 {
+			label = fmt.Sprintf("%s (%s)", label, opt.Desc)
+		}
+		if len(opt.Value) > 0 {
+			fmt.Fprintf(app.ErrOut, "%s: ", label)
+			value, err := readLine(in)
+			if err != nil {
+				return nil, err
+			}
+			if len(value) > 0 {
+				args = append(args, name+"="+value)
+			}
+		} else {
+			fmt.Fprintf(app.ErrOut, "%s [y/N]: ", label)
+			value, err := readLine(in)
+			if err != nil {
+				return nil, err
+			}
+			if value = strings.ToLower(value); value == "y" || value == "yes" {
+				args = append(args, name)
+			}
+		}
+	}
+	for _, usage := range cmdDocUsages(app, cmd) {
+		fmt.Fprintf(app.ErrOut, "Usage: %s\n", usage.Text)
+	}
+	fmt.Fprint(app.ErrOut, "Arguments: ")
+	line, err := readLine(in)
+	if err != nil {
+		return nil, err
+	}
+	words, err := splitWords(line)
+	if err != nil {
+		return nil, err
+	}
+	return append(args, words...), nil
+}
+
+// readLine reads a line of input, trimming surrounding whitespace.
+// Returns an error only if the input ends before any text is read.
+//
+func readLine(in *bufio.Reader) (string, error) {
+	line, err := in.ReadString('\n')
+	if err != nil && len(line) == 0 {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// splitWords splits the line into words, as a shell would, honoring single quotes, double quotes and backslash escapes.
+//
+func splitWords(line string) ([]string, error) {
+	var (
+		words []string
+		word  strings.Builder
+		quote rune
+		inWord,
+		escaped bool
+	)
+	for _, r := range line {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,29 @@
+package runfile
+
+import (
+	"strings"
+)
+
+// ProfileEnv selects the active profile, unless overridden by '--profile'.
+// It is also exported to scripts, with the active profile.
+//
+const ProfileEnv = "RUN_PROFILE"
+
+// AddProfile records the name of a PROFILE block, if not already known.
+//
+func (r *Runfile) AddProfile(name string) {
+	if !r.HasProfile(name) {
+		r.Profiles = append(r.Profiles, name)
+	}
+}
+
+// HasProfile returns true if the runfile declares the profile (case-insensitive).
+//
+func (r *Runfile) HasProfile(name string) bool {
+	for _, profile := range r.Profiles {
+		if strings.EqualFold(profile, name) {
+			return true
+		}
+	}
+	return false
+}
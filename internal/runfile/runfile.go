@@ -1,12 +1,21 @@
 package runfile
 
-import "github.com/tekwizely/run/internal/config"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tekwizely/run/internal/config"
+	"github.com/tekwizely/run/internal/exec"
+)
 
 // Runfile stores the processed file, ready to run.
 //
 type Runfile struct {
-	Scope *Scope
-	Cmds  []*RunCmd
+	Scope    *Scope
+	Cmds     []*RunCmd
+	Profiles []string // Names of the PROFILE blocks, in order of declaration
 }
 
 // NewRunfile is a convenience method.
@@ -18,6 +27,29 @@ func NewRunfile() *Runfile {
 	}
 }
 
+// FindCmd finds a command by name (case-insensitive), returning nil if not found.
+//
+func (r *Runfile) FindCmd(name string) *RunCmd {
+	for _, cmd := range r.Cmds {
+		if strings.EqualFold(cmd.Name, name) {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// AddGlobalCmds adds the commands from the global runfile, marking them as global.
+// Commands already defined in this runfile take precedence.
+//
+func (r *Runfile) AddGlobalCmds(global *Runfile) {
+	for _, cmd := range global.Cmds {
+		if r.FindCmd(cmd.Name) == nil {
+			cmd.Global = true
+			r.Cmds = append(r.Cmds, cmd)
+		}
+	}
+}
+
 // RunCmdOpt captures an OPTION
 //
 type RunCmdOpt struct {
@@ -28,22 +60,153 @@ type RunCmdOpt struct {
 	Desc  string
 }
 
+// Flags formats the option's flags and value label, i.e. "-n, --name <name>".
+//
+func (o *RunCmdOpt) Flags() string {
+	b := &strings.Builder{}
+	if o.Short != 0 {
+		b.WriteRune('-')
+		b.WriteRune(o.Short)
+	}
+	if o.Long != "" {
+		if o.Short != 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("--")
+		b.WriteString(o.Long)
+	}
+	if o.Value != "" {
+		b.WriteRune(' ')
+		b.WriteRune('<')
+		b.WriteString(o.Value)
+		b.WriteRune('>')
+	}
+	return b.String()
+}
+
+// RunCmdComplete captures a COMPLETE provider.
+// Target is either an option name or a positional argument (arg1, arg2, ...).
+//
+type RunCmdComplete struct {
+	Target string
+	Script string
+}
+
 // RunCmdConfig captures the configuration for a command.
 //
 type RunCmdConfig struct {
-	Shell  string
-	Desc   []string
-	Usages []string
-	Opts   []*RunCmdOpt
+	Shell      string
+	ShellFlags []string // Flags for the shell (SHELL name flags..., or .SHELLFLAGS)
+	Desc       []string
+	Usages     []string
+	Opts       []*RunCmdOpt
+	Completes  []*RunCmdComplete
+	Watch      []string // Globs, '!' prefix = ignore
+	Sources    []string // Globs
+	Outputs    []string // Globs
+	Timeout    time.Duration
+	Retry      *exec.RetryPolicy // nil = no retries
+	Confirm    string            // Prompt shown before running; "" = none
+	Before     []string          // Hook command names
+	After      []string          // Hook command names
+	Finally    []string          // Hook command names
+	ScriptMode string            // How the script is delivered to the shell (.SCRIPT_MODE); "" = default
+	Cache      bool              // Run '#!' scripts from the script cache
+}
+
+// ParseTimeout parses a TIMEOUT value, i.e. '90s' or '10m'.
+// Returns 0 (no timeout) for an empty value.
+//
+func ParseTimeout(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("invalid duration '%s': expecting i.e. '90s' or '10m'", value)
+	}
+	return timeout, nil
+}
+
+// ParseCache parses a CACHE value, i.e. 'true' or 'false'.
+// An empty value enables caching.
+//
+func ParseCache(value string) (bool, error) {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return true, nil
+	}
+	cache, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid value '%s': expecting 'true' or 'false'", value)
+	}
+	return cache, nil
+}
+
+// ParseRetry parses a RETRY value, i.e. '3 backoff=2s max=30s on=1,75'.
+// Returns nil (no retries) for an empty value.
+//
+func ParseRetry(value string) (*exec.RetryPolicy, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	retries, err := strconv.Atoi(fields[0])
+	if err != nil || retries < 0 {
+		return nil, fmt.Errorf("invalid retry count '%s': expecting a number, i.e. '3'", fields[0])
+	}
+	retry := &exec.RetryPolicy{Retries: retries, Backoff: exec.DefaultRetryBackoff}
+	for _, field := range fields[1:] {
+		i := strings.IndexRune(field, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("invalid setting '%s': expecting backoff=, max= or on=", field)
+		}
+		name, setting := strings.ToLower(field[:i]), field[i+1:]
+		switch name {
+		case "backoff", "max":
+			duration, err := time.ParseDuration(setting)
+			if err != nil || duration < 0 {
+				return nil, fmt.Errorf("invalid %s '%s': expecting i.e. '2s' or '1m'", name, setting)
+			}
+			if name == "backoff" {
+				retry.Backoff = duration
+			} else {
+				retry.Max = duration
+			}
+		case "on":
+			for _, s := range strings.Split(setting, ",") {
+				code, err := strconv.Atoi(s)
+				if err != nil || code < 1 || code > 255 {
+					return nil, fmt.Errorf("invalid exit code '%s': expecting 1-255", s)
+				}
+				retry.On = append(retry.On, code)
+			}
+		default:
+			return nil, fmt.Errorf("invalid setting '%s': expecting backoff=, max= or on=", field)
+		}
+	}
+	return retry, nil
 }
 
 // RunCmd captures a command.
 //
 type RunCmd struct {
 	Name   string
+	Global bool // Defined in the global runfile
 	Config *RunCmdConfig
 	Scope  *Scope
 	Script []string
+	Hooks  *RunCmdHooks // Set by Runfile.ResolveHooks
+}
+
+// Clone returns a copy of the command, with its own scope, for a single invocation.
+// Option values are stored in the scope, so invocations (which may run concurrently) must not share it.
+//
+func (c *RunCmd) Clone() *RunCmd {
+	inv := *c
+	inv.Scope = c.Scope.Clone()
+	return &inv
 }
 
 // Title fetches the first line of the description as the command title.
@@ -68,6 +231,12 @@ func (c *RunCmd) Shell() string {
 	return shell
 }
 
+// Executor fetches the executor for the command's shell, with the command's shell flags.
+//
+func (c *RunCmd) Executor(shell string) *exec.Executor {
+	return c.Scope.GetExecutor(shell).WithFlags(c.Config.ShellFlags)
+}
+
 // EnableHelp returns whether or not a help screen should be shown for a command.
 // Returns false if there isn't any custom informaiton to display.
 //
@@ -1,23 +1,63 @@
 package runfile
 
-import "os"
+import (
+	"os"
+
+	"github.com/tekwizely/run/internal/config"
+	"github.com/tekwizely/run/internal/exec"
+)
+
+// Assignment is a variable or attr assignment, as applied to a scope.
+//
+type Assignment interface {
+	Apply(app *config.App, s *Scope)
+}
 
 // Scope isolates attrs, vars and exports
 //
 type Scope struct {
-	Attrs   map[string]string // All keys uppercase. Keys include leading '.'
-	Vars    map[string]string // Variables
-	Exports []string          // Exported variables
+	Attrs        map[string]string         // All keys uppercase. Keys include leading '.'
+	Vars         map[string]string         // Variables
+	Exports      []string                  // Exported variables
+	Executors    map[string]*exec.Executor // Executors declared with .EXECUTOR, keyed by shell name
+	ProfileAttrs map[string]Assignment     // Attr assignments of the active profile, applied in place of any other
+	ProfileVars  map[string]Assignment     // Variable assignments of the active profile, applied in place of any other
 }
 
 // NewScope is a convenience method
 //
 func NewScope() *Scope {
 	return &Scope{
-		Attrs:   map[string]string{},
-		Vars:    map[string]string{},
-		Exports: []string{},
+		Attrs:        map[string]string{},
+		Vars:         map[string]string{},
+		Exports:      []string{},
+		Executors:    map[string]*exec.Executor{},
+		ProfileAttrs: map[string]Assignment{},
+		ProfileVars:  map[string]Assignment{},
+	}
+}
+
+// Clone returns a copy of the scope, which can be changed independently.
+//
+func (s *Scope) Clone() *Scope {
+	c := NewScope()
+	for k, v := range s.Attrs {
+		c.Attrs[k] = v
+	}
+	for k, v := range s.Vars {
+		c.Vars[k] = v
+	}
+	c.Exports = append(c.Exports, s.Exports...)
+	for k, v := range s.Executors {
+		c.Executors[k] = v
+	}
+	for k, v := range s.ProfileAttrs {
+		c.ProfileAttrs[k] = v
 	}
+	for k, v := range s.ProfileVars {
+		c.ProfileVars[k] = v
+	}
+	return c
 }
 
 // GetEnv fetches an env variable
@@ -52,6 +92,20 @@ func (s *Scope) PutVar(key, value string) {
 	s.Vars[key] = value
 }
 
+// GetProfileAttr fetches the active profile's assignment to an attr
+//
+func (s *Scope) GetProfileAttr(key string) (Assignment, bool) {
+	val, ok := s.ProfileAttrs[key]
+	return val, ok
+}
+
+// GetProfileVar fetches the active profile's assignment to a var
+//
+func (s *Scope) GetProfileVar(key string) (Assignment, bool) {
+	val, ok := s.ProfileVars[key]
+	return val, ok
+}
+
 // AddExport adds an var name to the list of exports
 //
 func (s *Scope) AddExport(key string) {
@@ -63,3 +117,18 @@ func (s *Scope) AddExport(key string) {
 func (s *Scope) GetExports() []string {
 	return s.Exports
 }
+
+// GetExecutor fetches the executor for a shell, as declared with .EXECUTOR, or from the registry
+//
+func (s *Scope) GetExecutor(shell string) *exec.Executor {
+	if e, ok := s.Executors[shell]; ok {
+		return e
+	}
+	return exec.LookupExecutor(shell)
+}
+
+// PutExecutor declares an executor
+//
+func (s *Scope) PutExecutor(e *exec.Executor) {
+	s.Executors[e.Name] = e
+}
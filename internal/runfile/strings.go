@@ -1,5 +1,14 @@
 package runfile
 
+// TrimQuotes removes a matching pair of quotes (single or double) surrounding the value, if present.
+//
+func TrimQuotes(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
 func defaultIfEmpty(src string, def string) string {
 	if len(src) > 0 {
 		return src
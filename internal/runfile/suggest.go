@@ -0,0 +1,193 @@
+package runfile
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/tekwizely/run/internal/config"
+	"github.com/tekwizely/run/internal/term"
+)
+
+// Autocorrect modes (.AUTOCORRECT)
+//
+const (
+	AutocorrectPrompt = "prompt"
+	AutocorrectRun    = "run"
+)
+
+// maxSuggestions limits how many suggestions are shown.
+//
+const maxSuggestions = 5
+
+// namespaceSeparators separate a command's namespace from its name (i.e. 'db_migrate').
+//
+const namespaceSeparators = "_:.-"
+
+// suggest returns the candidates closest to word, by edit distance, best first.
+// Candidates starting with word are also considered close.
+//
+func suggest(word string, candidates []string) []string {
+	type match struct {
+		name string
+		dist int
+	}
+	word = strings.ToLower(word)
+	threshold := len(word)/3 + 1
+	var matches []match
+	for _, candidate := range candidates {
+		name := strings.ToLower(candidate)
+		if name == word {
+			continue
+		}
+		dist := editDistance(word, name)
+		// Namespaced? Also compare against the name alone
+		//
+		if i := strings.LastIndexAny(name, namespaceSeparators); i >= 0 {
+			if d := editDistance(word, name[i+1:]); d < dist {
+				dist = d
+			}
+		}
+		if dist > threshold && len(word) > 1 && strings.HasPrefix(name, word) {
+			dist = threshold
+		}
+		if dist <= threshold {
+			matches = append(matches, match{name: candidate, dist: dist})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].dist != matches[j].dist {
+			return matches[i].dist < matches[j].dist
+		}
+		return matches[i].name < matches[j].name
+	})
+	var names []string
+	for i := 0; i < len(matches) && i < maxSuggestions; i++ {
+		names = append(names, matches[i].name)
+	}
+	return names
+}
+
+// editDistance computes the optimal string alignment distance between a and b:
+// The number of insertions, deletions, substitutions and adjacent transpositions needed to turn one into the other.
+//
+func editDistance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	// d[i][j] = distance between ra[:i] and rb[:j]
+	//
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+// minInt returns the smallest of the values.
+//
+func minInt(first int, rest ...int) int {
+	for _, v := range rest {
+		if v < first {
+			first = v
+		}
+	}
+	return first
+}
+
+// SuggestCmds returns the names of the commands closest to name, best first.
+//
+func SuggestCmds(app *config.App, name string) []string {
+	var names []string
+	for _, cmd := range app.CommandList {
+		names = append(names, cmd.Name)
+	}
+	return suggest(name, names)
+}
+
+// suggestOpts returns the long options of the command closest to the (unknown) option name, best first.
+//
+func suggestOpts(cmd *RunCmd, name string) []string {
+	var names []string
+	for _, opt := range cmdOptNames(cmd) {
+		if strings.HasPrefix(opt, "--") {
+			names = append(names, strings.TrimPrefix(opt, "--"))
+		}
+	}
+	suggestions := suggest(strings.TrimLeft(name, "-"), names)
+	for i, s := range suggestions {
+		suggestions[i] = "--" + s
+	}
+	return suggestions
+}
+
+// showSuggestions shows the suggestions, if any.
+//
+func showSuggestions(app *config.App, suggestions []string) {
+	if len(suggestions) == 0 {
+		return
+	}
+	if len(suggestions) == 1 {
+		fmt.Fprintln(app.ErrOut, "\nDid you mean this?")
+	} else {
+		fmt.Fprintln(app.ErrOut, "\nDid you mean one of these?")
+	}
+	for _, s := range suggestions {
+		fmt.Fprintf(app.ErrOut, "        %s\n", s)
+	}
+}
+
+// CommandNotFound reports an unknown command, suggesting similar commands, or listing all commands if there are none.
+// If the runfile enables .AUTOCORRECT and there is a single close match, the match is returned
+// (after confirming with the user, in 'prompt' mode), otherwise returns nil.
+//
+func CommandNotFound(app *config.App, rf *Runfile, name string) *config.Command {
+	suggestions := SuggestCmds(app, name)
+	if len(suggestions) == 1 {
+		mode, _ := rf.Scope.GetAttr(".AUTOCORRECT")
+		mode = strings.ToLower(strings.TrimSpace(mode))
+		match := app.CommandMap[strings.ToLower(suggestions[0])]
+		switch mode {
+		case "":
+		case AutocorrectRun:
+			log.Printf("command not found: %s: Assuming you meant '%s'", name, match.Name)
+			return match
+		case AutocorrectPrompt:
+			if term.IsTerminal(os.Stdin) {
+				fmt.Fprintf(app.ErrOut, "%s: command not found: %s: Did you mean '%s'? [y/N] ", app.Me, name, match.Name)
+				answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+				answer = strings.ToLower(strings.TrimSpace(answer))
+				if answer == "y" || answer == "yes" {
+					return match
+				}
+				return nil
+			}
+		default:
+			panic(fmt.Sprintf(".AUTOCORRECT: Invalid value '%s': Expecting '%s' or '%s'", mode, AutocorrectPrompt, AutocorrectRun))
+		}
+	}
+	log.Printf("command not found: %s", name)
+	if len(suggestions) > 0 {
+		showSuggestions(app, suggestions)
+	} else {
+		ListCommands(app)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package runfile
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tekwizely/run/internal/config"
+	"github.com/tekwizely/run/internal/glob"
+)
+
+// cacheDir holds up-to-date state, relative to the working directory.
+//
+const cacheDir = ".run/cache"
+
+// skipDirs are never searched when expanding SOURCES / OUTPUTS globs.
+//
+var skipDirs = []string{".git", ".run"}
+
+// checkUpToDate determines if the command can be skipped because its OUTPUTS are current with respect to its SOURCES.
+// In checksum mode, the computed checksum is also returned, to be saved once the command succeeds.
+//
+func checkUpToDate(app *config.App, cmd *RunCmd, shell string, args []string, env map[string]string) (bool, string) {
+	if len(cmd.Config.Sources) == 0 && len(cmd.Config.Outputs) == 0 {
+		return false, ""
+	}
+	sources, err := glob.Expand(".", cmd.Config.Sources, skipDirs...)
+	if err != nil {
+		log.Printf("%s: SOURCES: %v", cmd.Name, err)
+		return false, ""
+	}
+	// SOURCES must match at least one file, so that a mistyped glob doesn't leave the command up to date forever
+	//
+	if len(cmd.Config.Sources) > 0 && len(sources) == 0 {
+		return false, ""
+	}
+	// Every OUTPUTS glob must match at least one file
+	//
+	var outputs []string
+	for _, pattern := range cmd.Config.Outputs {
+		files, err := glob.Expand(".", []string{pattern}, skipDirs...)
+		if err != nil {
+			log.Printf("%s: OUTPUTS: %v", cmd.Name, err)
+			return false, ""
+		}
+		if len(files) == 0 {
+			outputs = nil
+			break
+		}
+		outputs = append(outputs, files...)
+	}
+	if app.UseChecksums {
+		sum, err := checksum(cmd, shell, args, env, sources)
+		if err != nil {
+			log.Printf("%s: SOURCES: %v", cmd.Name, err)
+			return false, ""
+		}
+		if app.ForceRun || (len(cmd.Config.Outputs) > 0 && outputs == nil) {
+			return false, sum
+		}
+		saved, err := ioutil.ReadFile(checksumFile(cmd))
+		return err == nil && strings.TrimSpace(string(saved)) == sum, sum
+	}
+	// Timestamps: Every output must be newer than the newest source
+	//
+	if app.ForceRun || outputs == nil {
+		return false, ""
+	}
+	newest, ok := modTimes(sources, func(t, m time.Time) bool { return t.After(m) })
+	if !ok {
+		return false, ""
+	}
+	oldest, ok := modTimes(outputs, func(t, m time.Time) bool { return m.IsZero() || t.Before(m) })
+	if !ok {
+		return false, ""
+	}
+	return oldest.After(newest), ""
+}
+
+// modTimes returns the modification time of the file selected by pick, or false if any file cannot be read.
+//
+func modTimes(files []string, pick func(t time.Time, m time.Time) bool) (time.Time, bool) {
+	var m time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return m, false
+		}
+		if pick(info.ModTime(), m) {
+			m = info.ModTime()
+		}
+	}
+	return m, true
+}
+
+// checksum hashes the source files, along with the command's script, shell, arguments and exported environment.
+//
+func checksum(cmd *RunCmd, shell string, args []string, env map[string]string, sources []string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "shell\x00%s\x00", shell)
+	for _, line := range cmd.Script {
+		fmt.Fprintf(h, "script\x00%s\x00", line)
+	}
+	for _, arg := range args {
+		fmt.Fprintf(h, "arg\x00%s\x00", arg)
+	}
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "env\x00%s=%s\x00", name, env[name])
+	}
+	for _, source := range sources {
+		fmt.Fprintf(h, "file\x00%s\x00", source)
+		f, err := os.Open(source)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checksumFile returns the file holding the command's last successful checksum.
+//
+func checksumFile(cmd *RunCmd) string {
+	return filepath.Join(cacheDir, strings.ToLower(cmd.Name)+".sha256")
+}
+
+// saveChecksum records the checksum of a successful run.
+//
+func saveChecksum(cmd *RunCmd, sum string) {
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		log.Printf("%s: unable to save checksum: %v", cmd.Name, err)
+		return
+	}
+	if err := ioutil.WriteFile(checksumFile(cmd), []byte(sum+"\n"), 0644); err != nil {
+		log.Printf("%s: unable to save checksum: %v", cmd.Name, err)
+	}
+}
@@ -0,0 +1,117 @@
+package runfile
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/tekwizely/run/internal/config"
+	"github.com/tekwizely/run/internal/exec"
+	"github.com/tekwizely/run/internal/watch"
+)
+
+// WatchDebounce is how long files must be quiet before a change triggers a re-run.
+//
+const WatchDebounce = 300 * time.Millisecond
+
+// RunWatch runs a command, re-running it whenever matching files change.
+// Globs are combined with the command's WATCH attribute, where a '!' prefix marks an ignore pattern.
+// A running command is terminated (along with its process group) before being restarted.
+// Runs until interrupted.
+//
+func RunWatch(app *config.App, cmd *RunCmd, args []string, includes []string, ignores []string, std *config.Stdio) int {
+	for _, glob := range cmd.Config.Watch {
+		if strings.HasPrefix(glob, "!") {
+			ignores = append(ignores, glob[1:])
+		} else {
+			includes = append(includes, glob)
+		}
+	}
+	if len(includes) == 0 {
+		log.Printf("%s: nothing to watch: use --watch <glob> or add a WATCH attribute", cmd.Name)
+		return 2
+	}
+	args = evaluateCmdOpts(app, cmd, args)
+	env := CmdEnv(cmd)
+	shell := cmd.Shell()
+	// Confirm once, rather than on every change
+	//
+	if err := ConfirmCmd(app, cmd, std); err != nil {
+		log.Printf("%s: %v", cmd.Name, err)
+		return ConfirmAbortCode
+	}
+
+	root, err := os.Getwd()
+	if err != nil {
+		log.Fatal(err)
+	}
+	watcher := watch.New(root, watch.NewMatcher(root, includes, ignores))
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	opts := exec.Options{Name: cmd.Name, KillGrace: app.KillGrace, Timeout: CmdTimeout(app, cmd), Retry: cmd.Config.Retry, ScriptMode: cmd.Config.ScriptMode, Cache: cmd.Config.Cache}
+	for {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan int, 1)
+		go func() {
+			code, err := ExecuteCmd(ctx, app, cmd, shell, args, env, std, opts)
+			if err != nil {
+				log.Printf("%s: %v", cmd.Name, err)
+			}
+			done <- code
+		}()
+		running := true
+		for running {
+			select {
+			case code := <-done:
+				fmt.Fprintf(app.ErrOut, "[watch] %s exited with code %d, waiting for changes\n", cmd.Name, code)
+				running = false
+				// Wait for the next change (or interrupt)
+				//
+				select {
+				case file := <-watcher.Changes:
+					debounce(watcher.Changes)
+					fmt.Fprintf(app.ErrOut, "[watch] %s changed, re-running %s\n", file, cmd.Name)
+				case <-signals:
+					cancel()
+					return 130
+				}
+			case file := <-watcher.Changes:
+				debounce(watcher.Changes)
+				fmt.Fprintf(app.ErrOut, "[watch] %s changed, restarting %s\n", file, cmd.Name)
+				cancel()
+				<-done
+				running = false
+			case <-signals:
+				cancel()
+				<-done
+				return 130
+			}
+		}
+		cancel()
+	}
+}
+
+// debounce waits until no changes have been reported for WatchDebounce.
+//
+func debounce(changes <-chan string) {
+	timer := time.NewTimer(WatchDebounce)
+	defer timer.Stop()
+	for {
+		select {
+		case <-changes:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(WatchDebounce)
+		case <-timer.C:
+			return
+		}
+	}
+}
@@ -0,0 +1,57 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package term
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrNotSupported is returned when raw mode is not available on the platform.
+//
+var ErrNotSupported = errors.New("raw terminal mode not supported")
+
+// State captures a terminal's settings, so they can be restored.
+//
+type State struct{}
+
+// isTerminal returns true if the file is a character device, as terminal settings are not available on this platform.
+//
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+// MakeRaw is not supported on this platform.
+//
+func MakeRaw(_ int) (*State, error) {
+	return nil, ErrNotSupported
+}
+
+// Restore is not supported on this platform.
+//
+func Restore(_ int, _ *State) error {
+	return ErrNotSupported
+}
+
+// Width is not supported on this platform.
+//
+func Width(_ int) (int, error) {
+	return 0, ErrNotSupported
+}
+
+// ForegroundGroup is not supported on this platform.
+//
+func ForegroundGroup(_ int) (int, error) {
+	return 0, ErrNotSupported
+}
+
+// SetForegroundGroup is not supported on this platform.
+//
+func SetForegroundGroup(_ int, _ int) error {
+	return ErrNotSupported
+}
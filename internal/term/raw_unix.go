@@ -0,0 +1,94 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package term
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// State captures a terminal's settings, so they can be restored.
+//
+type State struct {
+	termios syscall.Termios
+}
+
+// ioctl invokes the ioctl syscall.
+//
+func ioctl(fd int, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// isTerminal returns true if the terminal settings of the file can be fetched.
+// Unlike checking for a character device, this excludes i.e. /dev/null.
+//
+func isTerminal(f *os.File) bool {
+	var termios syscall.Termios
+	return ioctl(int(f.Fd()), ioctlGetTermios, unsafe.Pointer(&termios)) == nil
+}
+
+// MakeRaw puts the terminal into raw mode, returning its previous state.
+// Input is unbuffered and not echoed, and signal keys (i.e. ctrl-c) are read as input.
+// Output processing is left enabled, so '\n' still starts a new line.
+//
+func MakeRaw(fd int) (*State, error) {
+	state := &State{}
+	if err := ioctl(fd, ioctlGetTermios, unsafe.Pointer(&state.termios)); err != nil {
+		return nil, err
+	}
+	raw := state.termios
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctl(fd, ioctlSetTermios, unsafe.Pointer(&raw)); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Restore returns the terminal to a previous state.
+//
+func Restore(fd int, state *State) error {
+	return ioctl(fd, ioctlSetTermios, unsafe.Pointer(&state.termios))
+}
+
+// Width returns the width of the terminal, in columns.
+//
+func Width(fd int) (int, error) {
+	var ws struct {
+		Row, Col, Xpixel, Ypixel uint16
+	}
+	if err := ioctl(fd, syscall.TIOCGWINSZ, unsafe.Pointer(&ws)); err != nil {
+		return 0, err
+	}
+	return int(ws.Col), nil
+}
+
+// ForegroundGroup returns the terminal's foreground process group.
+//
+func ForegroundGroup(fd int) (int, error) {
+	var pgrp int32
+	if err := ioctl(fd, syscall.TIOCGPGRP, unsafe.Pointer(&pgrp)); err != nil {
+		return 0, err
+	}
+	return int(pgrp), nil
+}
+
+// SetForegroundGroup makes the process group the terminal's foreground process group.
+// SIGTTOU is ignored while doing so, as the caller may itself be in a background group.
+//
+func SetForegroundGroup(fd int, pgrp int) error {
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+	p := int32(pgrp)
+	return ioctl(fd, syscall.TIOCSPGRP, unsafe.Pointer(&p))
+}
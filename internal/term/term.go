@@ -0,0 +1,12 @@
+package term
+
+import "os"
+
+// IsTerminal returns true if the file is connected to a terminal.
+//
+func IsTerminal(f *os.File) bool {
+	if f == nil {
+		return false
+	}
+	return isTerminal(f)
+}
@@ -0,0 +1,22 @@
+package term
+
+import (
+	"os"
+	"testing"
+)
+
+// TestIsTerminal checks that character devices which are not terminals are not mistaken for one.
+//
+func TestIsTerminal(t *testing.T) {
+	if IsTerminal(nil) {
+		t.Error("nil: got true, want false")
+	}
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer null.Close()
+	if IsTerminal(null) {
+		t.Errorf("%s: got true, want false", os.DevNull)
+	}
+}
@@ -0,0 +1,136 @@
+package watch
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/tekwizely/run/internal/glob"
+)
+
+// alwaysIgnored lists directories that are never watched.
+//
+var alwaysIgnored = []string{".git", ".run"}
+
+// Matcher decides which paths (relative to the watch root, '/'-separated) are watched.
+//
+type Matcher struct {
+	Includes  []string // Glob patterns, supporting '**'
+	Ignores   []string // Glob patterns, supporting '**'
+	gitignore []*gitignoreRule
+}
+
+// NewMatcher creates a matcher for the include/ignore globs, respecting the root's .gitignore, if present.
+//
+func NewMatcher(root string, includes []string, ignores []string) *Matcher {
+	m := &Matcher{Includes: includes, Ignores: ignores}
+	m.gitignore = readGitignore(filepath.Join(root, ".gitignore"))
+	return m
+}
+
+// Match returns true if the file should trigger a change.
+//
+func (m *Matcher) Match(rel string) bool {
+	if m.Ignored(rel, false) {
+		return false
+	}
+	for _, pattern := range m.Includes {
+		if glob.Match(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// Ignored returns true if the path is excluded by an ignore pattern or .gitignore.
+// Files within an ignored directory are also ignored.
+//
+func (m *Matcher) Ignored(rel string, isDir bool) bool {
+	parts := strings.Split(rel, "/")
+	for i := range parts {
+		sub := strings.Join(parts[:i+1], "/")
+		subIsDir := isDir || i < len(parts)-1
+		if subIsDir {
+			for _, dir := range alwaysIgnored {
+				if parts[i] == dir {
+					return true
+				}
+			}
+		}
+		for _, pattern := range m.Ignores {
+			if glob.Match(pattern, sub) {
+				return true
+			}
+		}
+		if m.gitignored(sub, subIsDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// gitignoreRule is a single .gitignore pattern.
+//
+type gitignoreRule struct {
+	pattern  string
+	negate   bool // '!' prefix re-includes
+	dirOnly  bool // '/' suffix only matches directories
+	anchored bool // Contains a '/', so matched against the full path rather than any segment
+}
+
+// readGitignore reads the rules from a .gitignore file, returning nil if not present.
+//
+func readGitignore(file string) []*gitignoreRule {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var rules []*gitignoreRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t")
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := &gitignoreRule{}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// gitignored applies the .gitignore rules to the path.  Later rules take precedence.
+//
+func (m *Matcher) gitignored(rel string, isDir bool) bool {
+	ignored := false
+	for _, rule := range m.gitignore {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		var ok bool
+		if rule.anchored {
+			ok = glob.Match(rule.pattern, rel)
+		} else {
+			ok, _ = path.Match(rule.pattern, path.Base(rel))
+		}
+		if ok {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
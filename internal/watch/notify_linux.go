@@ -0,0 +1,92 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// notifyMask selects the inotify events that indicate a change.
+//
+const notifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ATTRIB
+
+// notifier tracks inotify watch descriptors.
+//
+type notifier struct {
+	fd   int
+	dirs map[int32]string // Watch descriptor -> directory
+}
+
+// startNotify starts an inotify watcher, returning false if inotify is unavailable.
+//
+func (w *Watcher) startNotify() bool {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return false
+	}
+	n := &notifier{fd: fd, dirs: make(map[int32]string)}
+	if err = n.addTree(w, w.root); err != nil {
+		_ = syscall.Close(fd)
+		return false
+	}
+	go n.read(w)
+	return true
+}
+
+// addTree adds watches for the directory and all of its (non-ignored) sub-directories.
+//
+func (n *notifier) addTree(w *Watcher, root string) error {
+	return filepath.Walk(root, func(dir string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if dir != w.root && w.matcher.Ignored(w.relPath(dir), true) {
+			return filepath.SkipDir
+		}
+		wd, err := syscall.InotifyAddWatch(n.fd, dir, notifyMask)
+		if err != nil {
+			return err // i.e. out of watches, fall back to polling
+		}
+		n.dirs[int32(wd)] = dir
+		return nil
+	})
+}
+
+// read processes inotify events until the descriptor is closed.
+//
+func (n *notifier) read(w *Watcher) {
+	var buf [64 * 1024]byte
+	for {
+		count, err := syscall.Read(n.fd, buf[:])
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil || count <= 0 {
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= count; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			name := strings.TrimRight(string(buf[nameStart:nameStart+int(event.Len)]), "\x00")
+			offset = nameStart + int(event.Len)
+
+			dir, ok := n.dirs[event.Wd]
+			if !ok || len(name) == 0 {
+				continue
+			}
+			file := filepath.Join(dir, name)
+			if event.Mask&syscall.IN_ISDIR != 0 {
+				// Watch new directories
+				//
+				if event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+					_ = n.addTree(w, file)
+				}
+				continue
+			}
+			w.changed(w.relPath(file))
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package watch
+
+// startNotify returns false, file notifications are only supported on linux.
+//
+func (w *Watcher) startNotify() bool {
+	return false
+}
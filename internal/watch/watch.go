@@ -0,0 +1,105 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// PollInterval is how often the polling watcher scans for changes.
+//
+const PollInterval = 500 * time.Millisecond
+
+// Watcher reports changes to matching files under a root directory.
+// Uses OS file notifications where supported, falling back to polling.
+//
+type Watcher struct {
+	root    string
+	matcher *Matcher
+	// Changes receives the path (relative to root) of each changed file.
+	//
+	Changes chan string
+}
+
+// New starts watching the root directory for changes to files accepted by the matcher.
+//
+func New(root string, matcher *Matcher) *Watcher {
+	w := &Watcher{root: root, matcher: matcher, Changes: make(chan string, 64)}
+	if !w.startNotify() {
+		go w.poll()
+	}
+	return w
+}
+
+// changed reports a change, if the file is accepted by the matcher.
+// Changes are dropped if the channel is full, since the consumer only needs to know *something* changed.
+//
+func (w *Watcher) changed(rel string) {
+	if w.matcher.Match(rel) {
+		select {
+		case w.Changes <- rel:
+		default:
+		}
+	}
+}
+
+// relPath returns the '/'-separated path relative to the watch root.
+//
+func (w *Watcher) relPath(file string) string {
+	rel, err := filepath.Rel(w.root, file)
+	if err != nil {
+		return filepath.ToSlash(file)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// fileState is what the polling watcher compares to detect changes.
+//
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// poll periodically scans the root for added, removed or modified files.
+//
+func (w *Watcher) poll() {
+	prev := w.scan()
+	for {
+		time.Sleep(PollInterval)
+		next := w.scan()
+		for rel, state := range next {
+			if old, ok := prev[rel]; !ok || old != state {
+				w.changed(rel)
+			}
+		}
+		for rel := range prev {
+			if _, ok := next[rel]; !ok {
+				w.changed(rel)
+			}
+		}
+		prev = next
+	}
+}
+
+// scan captures the state of all matching files under the root.
+//
+func (w *Watcher) scan() map[string]fileState {
+	states := make(map[string]fileState)
+	_ = filepath.Walk(w.root, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil // Skip unreadable entries
+		}
+		rel := w.relPath(file)
+		if info.IsDir() {
+			if file != w.root && w.matcher.Ignored(rel, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if w.matcher.Match(rel) {
+			states[rel] = fileState{modTime: info.ModTime(), size: info.Size()}
+		}
+		return nil
+	})
+	return states
+}
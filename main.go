@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 
 	"github.com/tekwizely/run/internal/ast"
@@ -17,13 +21,34 @@ import (
 )
 
 const (
-	runfileDefault = "Runfile"
+	runfileDefault      = "Runfile"
+	runfileStdin        = "-"
+	runfileFdPrefix     = "/dev/fd/"
+	completeCmdName     = "__complete"
+	invocationSeparator = "+"
+)
+
+// Working directory modes (.WORKDIR)
+//
+const (
+	workDirInvocation = "invocation"
+	workDirRunfile    = "runfile"
 )
 
 var (
-	inputFile   string
-	shebangMode bool
-	mainMode    bool
+	inputFiles    stringList
+	runfileSearch bool // Search parent directories for the runfile
+	globalOnly    bool // Only load the global runfile
+	pickMode      bool // Pick the command interactively
+	shebangMode   bool
+	mainMode      bool
+	parallel      bool
+	jobs          int
+	watchMode     bool
+	watchGlobs    stringList
+	watchIgnore   stringList
+	setVars       stringList // --set NAME=value
+	profileName   string     // --profile name
 )
 var (
 	hidePanic = false // Hide full trace on panics
@@ -31,35 +56,76 @@ var (
 
 // showUsage exits with error code 2.
 //
-func showUsage() {
+func showUsage(app *config.App) {
 	runfileOpt := ""
-	if config.EnableRunfileOverride {
+	if app.EnableRunfileOverride {
 		runfileOpt = "[-r runfile] "
 	}
-	pad := strings.Repeat(" ", len(config.Me)-1)
-	fmt.Fprintf(config.ErrOut, "Usage:\n")
-	fmt.Fprintf(config.ErrOut, "       %s -h | --help\n", config.Me)
-	fmt.Fprintf(config.ErrOut, "       %s (show help)\n", pad)
-	fmt.Fprintf(config.ErrOut, "  or   %s %slist\n", config.Me, runfileOpt)
-	fmt.Fprintf(config.ErrOut, "       %s (list commands)\n", pad)
-	fmt.Fprintf(config.ErrOut, "  or   %s %shelp <command>\n", config.Me, runfileOpt)
-	fmt.Fprintf(config.ErrOut, "       %s (show help for <command>)\n", pad)
-	fmt.Fprintf(config.ErrOut, "  or   %s %s<command> [option ...]\n", config.Me, runfileOpt)
-	fmt.Fprintf(config.ErrOut, "       %s (run <command>)\n", pad)
-	fmt.Fprintln(config.ErrOut, "Options:")
-	fmt.Fprintln(config.ErrOut, "  -h, --help")
-	fmt.Fprintln(config.ErrOut, "        Show help screen")
-	if config.EnableRunfileOverride {
-		fmt.Fprintln(config.ErrOut, "  -r, --runfile <file>")
-		fmt.Fprintf(config.ErrOut, "        Specify runfile (default='%s')\n", runfileDefault)
-	}
-	fmt.Fprintln(config.ErrOut, "Note:")
-	fmt.Fprintln(config.ErrOut, "  Options accept '-' | '--'")
-	fmt.Fprintln(config.ErrOut, "  Values can be given as:")
-	fmt.Fprintln(config.ErrOut, "        -o value | -o=value")
-	fmt.Fprintln(config.ErrOut, "  Flags (booleans) can be given as:")
-	fmt.Fprintln(config.ErrOut, "        -f | -f=true | -f=false")
-	fmt.Fprintln(config.ErrOut, "  Short options cannot be combined")
+	pad := strings.Repeat(" ", len(app.Me)-1)
+	fmt.Fprintf(app.ErrOut, "Usage:\n")
+	fmt.Fprintf(app.ErrOut, "       %s -h | --help\n", app.Me)
+	fmt.Fprintf(app.ErrOut, "       %s (show help)\n", pad)
+	fmt.Fprintf(app.ErrOut, "  or   %s %slist [--format json|yaml|tsv]\n", app.Me, runfileOpt)
+	fmt.Fprintf(app.ErrOut, "       %s (list commands)\n", pad)
+	fmt.Fprintf(app.ErrOut, "  or   %s %sdocs [--format markdown|man|html]\n", app.Me, runfileOpt)
+	fmt.Fprintf(app.ErrOut, "       %s (generate documentation for commands)\n", pad)
+	fmt.Fprintf(app.ErrOut, "  or   %s %shelp <command>\n", app.Me, runfileOpt)
+	fmt.Fprintf(app.ErrOut, "       %s (show help for <command>)\n", pad)
+	fmt.Fprintf(app.ErrOut, "  or   %s %scache [clean [--max-size <size>]]\n", app.Me, runfileOpt)
+	fmt.Fprintf(app.ErrOut, "       %s (show or clean the script cache)\n", pad)
+	fmt.Fprintf(app.ErrOut, "  or   %s %s<command> [option ...]\n", app.Me, runfileOpt)
+	fmt.Fprintf(app.ErrOut, "       %s (run <command>)\n", pad)
+	fmt.Fprintf(app.ErrOut, "  or   %s %s[-j N] [--parallel] <command> [option ...] [+ <command> [option ...]] ...\n", app.Me, runfileOpt)
+	fmt.Fprintf(app.ErrOut, "       %s (run several commands)\n", pad)
+	fmt.Fprintf(app.ErrOut, "  or   %s %s-i | --interactive\n", app.Me, runfileOpt)
+	fmt.Fprintf(app.ErrOut, "       %s (pick a command to run)\n", pad)
+	fmt.Fprintln(app.ErrOut, "Options:")
+	fmt.Fprintln(app.ErrOut, "  -h, --help")
+	fmt.Fprintln(app.ErrOut, "        Show help screen")
+	fmt.Fprintln(app.ErrOut, "  --parallel")
+	fmt.Fprintln(app.ErrOut, "        Run several commands concurrently")
+	fmt.Fprintln(app.ErrOut, "  -j, --jobs <N>")
+	fmt.Fprintln(app.ErrOut, "        Run at most N commands at a time (implies --parallel)")
+	fmt.Fprintln(app.ErrOut, "  -w")
+	fmt.Fprintln(app.ErrOut, "        Watch mode: Re-run <command> when files matching its WATCH globs change")
+	fmt.Fprintln(app.ErrOut, "  --watch <glob>")
+	fmt.Fprintln(app.ErrOut, "        Watch mode: Re-run <command> when files matching <glob> change (implies -w)")
+	fmt.Fprintln(app.ErrOut, "  --watch-ignore <glob>")
+	fmt.Fprintln(app.ErrOut, "        Ignore files matching <glob> in watch mode")
+	fmt.Fprintln(app.ErrOut, "  --dry-run[=text|json]")
+	fmt.Fprintln(app.ErrOut, "        Print the resolved command instead of running it")
+	fmt.Fprintln(app.ErrOut, "  --show-secrets")
+	fmt.Fprintln(app.ErrOut, "        Don't mask secret-looking variables in --dry-run output")
+	fmt.Fprintln(app.ErrOut, "  --checksum")
+	fmt.Fprintln(app.ErrOut, "        Compare SOURCES by content hash instead of modification time")
+	fmt.Fprintln(app.ErrOut, "  --force")
+	fmt.Fprintln(app.ErrOut, "        Run commands even if their OUTPUTS are up to date")
+	fmt.Fprintln(app.ErrOut, "  --yes")
+	fmt.Fprintln(app.ErrOut, "        Answer 'yes' to CONFIRM prompts (or set RUN_ASSUME_YES=1)")
+	fmt.Fprintln(app.ErrOut, "  --timeout <duration>")
+	fmt.Fprintln(app.ErrOut, "        Override the TIMEOUT of every command ('0' = no timeout)")
+	fmt.Fprintln(app.ErrOut, "  --set <name>=<value>")
+	fmt.Fprintln(app.ErrOut, "        Override a runfile variable (requires .CLI_VARS); or give trailing <name>=<value> arguments")
+	fmt.Fprintln(app.ErrOut, "  --profile <name>")
+	fmt.Fprintf(app.ErrOut, "        Apply the runfile's PROFILE <name> overrides (or set %s=<name>)\n", runfile.ProfileEnv)
+	fmt.Fprintln(app.ErrOut, "  --grace <duration>")
+	fmt.Fprintf(app.ErrOut, "        How long an interrupted command may take to exit before it is killed (default=%s)\n", config.DefaultKillGrace)
+	if app.EnableRunfileOverride {
+		fmt.Fprintln(app.ErrOut, "  -r, --runfile <file>")
+		fmt.Fprintf(app.ErrOut, "        Specify runfile (default='%s')\n", runfileDefault)
+		fmt.Fprintf(app.ErrOut, "        Use '%s' to read from stdin.  Repeat to merge several runfiles, in order\n", runfileStdin)
+		fmt.Fprintln(app.ErrOut, "  --runfile-fd <N>")
+		fmt.Fprintln(app.ErrOut, "        Read runfile from file descriptor N (leaves stdin for the command)")
+		fmt.Fprintln(app.ErrOut, "  -g, --global")
+		fmt.Fprintln(app.ErrOut, "        Only use the global runfile")
+	}
+	fmt.Fprintln(app.ErrOut, "Note:")
+	fmt.Fprintln(app.ErrOut, "  Options accept '-' | '--'")
+	fmt.Fprintln(app.ErrOut, "  Values can be given as:")
+	fmt.Fprintln(app.ErrOut, "        -o value | -o=value")
+	fmt.Fprintln(app.ErrOut, "  Flags (booleans) can be given as:")
+	fmt.Fprintln(app.ErrOut, "        -f | -f=true | -f=false")
+	fmt.Fprintln(app.ErrOut, "  Short options cannot be combined")
 	// flag.PrintDefaults()
 	os.Exit(2)
 }
@@ -67,8 +133,7 @@ func showUsage() {
 // main
 //
 func main() {
-	config.ErrOut = os.Stderr
-	config.Me = path.Base(os.Args[0])
+	app := config.NewApp(path.Base(os.Args[0]), os.Stderr)
 	// Configure logging
 	//
 	log.SetFlags(0)
@@ -85,139 +150,643 @@ func main() {
 	// Shebang?
 	//
 	var shebangFile string
-	if len(os.Args) > 1 && strings.EqualFold(os.Args[1], "shebang") {
-		os.Args = append(os.Args[:1], os.Args[2:]...)
-		if len(os.Args) > 1 {
-			shebangFile = os.Args[1]
-			os.Args = append(os.Args[:1], os.Args[2:]...)
+	args := os.Args[1:]
+	if len(args) > 0 && strings.EqualFold(args[0], "shebang") {
+		args = args[1:]
+		if len(args) > 0 {
+			shebangFile = args[0]
+			args = args[1:]
 		}
 		shebangMode = len(shebangFile) > 0 && path.Base(shebangFile) != runfileDefault
 	}
 	// In shebang mode, we defer parsing args until we know if we are in "main" mode
 	//
+	runfileSearch = !shebangMode
 	if shebangMode {
-		config.Me = path.Base(shebangFile) // Script Name = executable Name for Help
-		inputFile = shebangFile            // shebang file = runfile
-		config.EnableRunfileOverride = false
+		app.Me = path.Base(shebangFile)      // Script Name = executable Name for Help
+		inputFiles = stringList{shebangFile} // shebang file = runfile
+		app.EnableRunfileOverride = false
 	} else {
-		parseArgs()
+		args = parseArgs(app, args)
 	}
-	// Verify file exists
+	// Global runfile
 	//
-	if stat, err := os.Stat(inputFile); err == nil {
-		if !stat.Mode().IsRegular() {
-			log.Printf("Error reading file '%s': File not considered 'regular'\n", inputFile)
-			showUsage() // exits
+	var globalFile string
+	if !shebangMode {
+		globalFile = globalRunfile()
+	}
+	if globalOnly {
+		if len(globalFile) == 0 {
+			log.Printf("Global runfile not supported: Unable to determine user config directory")
+			showUsage(app) // exits
 		}
-	} else {
-		log.Printf("Input file not found: '%s' : Please create the file or specify an alternative", inputFile)
-		showUsage() // exits
+		inputFiles = stringList{globalFile}
+		runfileSearch = false
 	}
-	// Read file into memory
-	//
-	fileBytes, err := readFile(inputFile)
+	if len(inputFiles) == 0 {
+		inputFiles = stringList{runfileDefault}
+	}
+	invocationDir, err := os.Getwd()
 	if err != nil {
-		log.Printf("Error reading file '%s': %s\n", inputFile, err.Error())
-		showUsage() // exits
+		log.Fatal(err)
+	}
+	// Search parent directories?
+	//
+	if runfileSearch {
+		if found, ok := runfile.Find(invocationDir, inputFiles[0]); ok {
+			inputFiles[0] = found
+		}
+	}
+	// Verify files exist
+	//
+	stdinCnt := 0
+	for i, file := range inputFiles {
+		if file == runfileStdin || strings.HasPrefix(file, runfileFdPrefix) {
+			if file == runfileStdin {
+				stdinCnt++
+			}
+			continue
+		}
+		if stat, err := os.Stat(file); err == nil {
+			if stat.IsDir() {
+				log.Printf("Error reading file '%s': File is a directory\n", file)
+				showUsage(app) // exits
+			}
+		} else {
+			log.Printf("Input file not found: '%s' : Please create the file or specify an alternative", file)
+			showUsage(app) // exits
+		}
+		// We may change directory before reading
+		//
+		if inputFiles[i], err = filepath.Abs(file); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if stdinCnt > 1 {
+		log.Printf("Runfile '%s' (stdin) specified more than once", runfileStdin)
+		showUsage(app) // exits
+	}
+	// Expose locations to scripts
+	// The first runfile is considered the primary runfile
+	//
+	runfilePath := inputFiles[0]
+	runfileDir := filepath.Dir(runfilePath)
+	if !filepath.IsAbs(runfilePath) {
+		runfileDir = invocationDir // stdin | fd
+	}
+	_ = os.Setenv("RUNFILE", runfilePath)
+	_ = os.Setenv("RUNFILE_DIR", runfileDir)
+	_ = os.Setenv("RUN_INVOCATION_DIR", invocationDir)
+	// A runfile found by searching runs from its own directory by default
+	//
+	workDirs := map[string]string{workDirInvocation: invocationDir, workDirRunfile: runfileDir}
+	workDir := workDirInvocation
+	if runfileSearch {
+		workDir = workDirRunfile
+	}
+	if err = os.Chdir(workDirs[workDir]); err != nil {
+		log.Fatal(err)
+	}
+	// Profile
+	// '--profile' takes precedence over the environment, and the active profile is exposed to scripts
+	//
+	app.Profile = os.Getenv(runfile.ProfileEnv)
+	if len(profileName) > 0 {
+		app.Profile = profileName
+		_ = os.Setenv(runfile.ProfileEnv, app.Profile)
+	}
+	// Command-line variables
+	// Trailing 'NAME=value' arguments are only split off if the runfile enables .CLI_VARS, which is checked once parsed
+	//
+	cmdArgs, cliVars := runfile.SplitCLIVars(args)
+	app.CLIVars = make(map[string]string)
+	for _, arg := range setVars {
+		name, value, ok := runfile.ParseCLIVar(arg)
+		if !ok {
+			log.Printf("--set: expecting NAME=value: '%s'", arg)
+			showUsage(app) // exits
+		}
+		app.CLIVars[name] = value
+	}
+	for name, value := range cliVars {
+		app.CLIVars[name] = value
 	}
 	// Parse the file
 	//
-	rfAst := parser.Parse(lexer.Lex(fileBytes))
-	rf := ast.ProcessAST(rfAst)
+	rf := parseRunfiles(app, inputFiles)
+	if runfile.CLIVarsEnabled(rf.Scope) {
+		args = cmdArgs
+	} else if len(setVars) > 0 {
+		log.Printf("--set: command-line variables are not enabled: add '%s = true' to the runfile", runfile.CLIVarsAttr)
+		showUsage(app) // exits
+	}
+	// .WORKDIR
+	//
+	if value, ok := rf.Scope.GetAttr(".WORKDIR"); ok {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if _, ok := workDirs[value]; !ok {
+			panic(fmt.Sprintf(".WORKDIR: Invalid value '%s': Expecting '%s' or '%s'", value, workDirInvocation, workDirRunfile))
+		}
+		if value != workDir {
+			if err = os.Chdir(workDirs[value]); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	// Merge global commands
+	//
+	if !globalOnly && len(globalFile) > 0 && !containsString(inputFiles, globalFile) {
+		if stat, err := os.Stat(globalFile); err == nil && stat.Mode().IsRegular() {
+			global := parseRunfiles(app, []string{globalFile})
+			rf.AddGlobalCmds(global)
+			for _, name := range global.Profiles {
+				rf.AddProfile(name)
+			}
+		}
+	}
+	// Verify the active profile
+	// RUN_PROFILE may be set globally, so it is ignored by runfiles that declare no profiles
+	//
+	app.Profiles = rf.Profiles
+	if len(profileName) == 0 && len(rf.Profiles) == 0 {
+		app.Profile = ""
+	}
+	if len(app.Profile) > 0 && !rf.HasProfile(app.Profile) {
+		if len(rf.Profiles) == 0 {
+			log.Printf("unknown profile '%s': no profiles defined", app.Profile)
+		} else {
+			log.Printf("unknown profile '%s': expecting one of: %s", app.Profile, strings.Join(rf.Profiles, ", "))
+		}
+		showUsage(app) // exits
+	}
+	rf.ResolveHooks()
 	// Setup Commands
 	//
 	listCmd := &config.Command{
-		Name:   "list",
-		Title:  "(builtin) List available commands",
-		Help:   func() { runfile.ListCommands() },
-		Run:    func() { runfile.ListCommands() },
-		Rename: func(_ string) {},
+		Name:    "list",
+		Title:   "(builtin) List available commands",
+		Builtin: true,
+		Help:    func() { runfile.ListCommands(app) },
+		Run:     func(_ context.Context, args []string, std *config.Stdio) int { return runfile.RunList(app, rf, args, std) },
+		Rename:  func(_ string) {},
 	}
 	helpCmd := &config.Command{
-		Name:   "help",
-		Title:  "(builtin) Show Help for a command",
-		Help:   showUsage,
-		Run:    func() { runfile.RunHelp(rf) },
-		Rename: func(_ string) {},
-	}
-	config.CommandMap["list"] = listCmd
-	config.CommandMap["help"] = helpCmd
-	config.CommandList = append(config.CommandList, listCmd, helpCmd)
-	builtinCnt := len(config.CommandList)
+		Name:    "help",
+		Title:   "(builtin) Show Help for a command",
+		Builtin: true,
+		Help:    func() { showUsage(app) },
+		Run:     func(_ context.Context, args []string, _ *config.Stdio) int { return runfile.RunHelp(app, rf, args) },
+		Rename:  func(_ string) {},
+	}
+	docsCmd := &config.Command{
+		Name:    "docs",
+		Title:   "(builtin) Generate documentation for commands",
+		Builtin: true,
+		Help:    func() { showUsage(app) },
+		Run:     func(_ context.Context, args []string, std *config.Stdio) int { return runfile.RunDocs(app, rf, args, std) },
+		Rename:  func(_ string) {},
+	}
+	cacheCmd := &config.Command{
+		Name:    "cache",
+		Title:   "(builtin) Show or clean the script cache",
+		Builtin: true,
+		Help:    func() { showUsage(app) },
+		Run:     func(_ context.Context, args []string, std *config.Stdio) int { return runfile.RunCache(app, args, std) },
+		Rename:  func(_ string) {},
+	}
+	// Hidden entry point for shell completion scripts - Not shown in command list
+	//
+	completeCmd := &config.Command{
+		Name:    completeCmdName,
+		Builtin: true,
+		Help:    func() { showUsage(app) },
+		Run:     func(_ context.Context, args []string, _ *config.Stdio) int { return runfile.RunComplete(app, rf, args) },
+		Rename:  func(_ string) {},
+	}
+	app.AddCommand(listCmd, true)
+	app.AddCommand(helpCmd, true)
+	// Runfiles that predate the docs and cache builtins may define their own 'docs' and 'cache' commands
+	//
+	if rf.FindCmd(docsCmd.Name) == nil {
+		app.AddCommand(docsCmd, true)
+	}
+	if rf.FindCmd(cacheCmd.Name) == nil {
+		app.AddCommand(cacheCmd, true)
+	}
+	app.AddCommand(completeCmd, false)
+	builtinCnt := len(app.CommandList)
 	for _, rfcmd := range rf.Cmds {
 		name := strings.ToLower(rfcmd.Name) // normalize
-		if _, ok := config.CommandMap[name]; ok {
+		if _, ok := app.CommandMap[name]; ok {
 			panic("Duplicate command: " + name)
 		}
 		cmd := &config.Command{
 			Name:   rfcmd.Name,
 			Title:  rfcmd.Title(),
-			Help:   func(c *runfile.RunCmd) func() { return func() { runfile.ShowCmdHelp(c) } }(rfcmd),
-			Run:    func(c *runfile.RunCmd) func() { return func() { runfile.RunCommand(c) } }(rfcmd),
+			Global: rfcmd.Global,
+			Help:   func(c *runfile.RunCmd) func() { return func() { runfile.ShowCmdHelp(app, c) } }(rfcmd),
+			Run: func(c *runfile.RunCmd) func(context.Context, []string, *config.Stdio) int {
+				return func(ctx context.Context, args []string, std *config.Stdio) int {
+					return runfile.RunCommand(ctx, app, c, args, std)
+				}
+			}(rfcmd),
+			Check: func(c *runfile.RunCmd) func([]string) {
+				return func(args []string) { runfile.CheckCmdArgs(app, c, args) }
+			}(rfcmd),
 			Rename: func(c *runfile.RunCmd) func(string) { return func(s string) { c.Name = s } }(rfcmd),
 		}
-		config.CommandMap[name] = cmd
-		config.CommandList = append(config.CommandList, cmd)
+		app.AddCommand(cmd, true)
 	}
 	// In shebang mode, if only 1 runfile command defined, named "main", default to it directly
 	//
 	mainMode = shebangMode &&
-		len(config.CommandList) == (builtinCnt+1) &&
-		strings.EqualFold(config.CommandList[builtinCnt].Name, "main")
+		len(app.CommandList) == (builtinCnt+1) &&
+		strings.EqualFold(app.CommandList[builtinCnt].Name, "main")
 	// Determine which command to run
 	//
 	var cmdName string
 	if mainMode {
 		// In main mode, we defer parsing args to the command
 		//
-		os.Args = os.Args[1:] // Discard 'Me'
 		cmdName = "main"
-		config.CommandList[builtinCnt].Rename(config.Me) // Print Help as script Name
+		app.CommandList[builtinCnt].Rename(app.Me) // Print Help as script Name
 	} else {
 		// If we deferred parsing args, now is the time
 		//
 		if shebangMode {
-			parseArgs()
+			args = parseArgs(app, args)
+			if len(setVars) > 0 {
+				log.Printf("--set: not supported in shebang mode")
+				showUsage(app) // exits
+			}
+			if len(profileName) > 0 {
+				log.Printf("--profile: not supported in shebang mode: set %s instead", runfile.ProfileEnv)
+				showUsage(app) // exits
+			}
 		}
-		if len(os.Args) > 0 {
-			cmdName, os.Args = os.Args[0], os.Args[1:]
+		if pickMode && len(args) > 0 {
+			log.Printf("unexpected arguments for interactive mode: %s", strings.Join(args, " "))
+			showUsage(app) // exits
+		}
+		if len(args) > 0 {
+			cmdName, args = args[0], args[1:]
+		} else if def, ok := rf.Scope.GetAttr(".DEFAULT"); ok && len(strings.TrimSpace(def)) > 0 {
+			// Default = .DEFAULT command (or picker)
+			//
+			cmdName = strings.TrimSpace(def)
 		} else {
 			// Default = first command in command list
 			//
-			cmdName = config.CommandList[0].Name
+			cmdName = app.CommandList[0].Name
+		}
+	}
+	// Commands run until they exit; Signals received by run are forwarded to them
+	//
+	ctx := context.Background()
+	// Pick command interactively?
+	//
+	if !mainMode && (pickMode || cmdName == runfile.PickCommand) {
+		os.Exit(runfile.RunPicker(ctx, app, rf, config.OSStdio()))
+	}
+	// Watch mode?
+	//
+	if watchMode {
+		rfcmd := rf.FindCmd(cmdName)
+		if rfcmd == nil {
+			if cmd := runfile.CommandNotFound(app, rf, cmdName); cmd != nil {
+				rfcmd = rf.FindCmd(cmd.Name)
+			}
+			if rfcmd == nil {
+				os.Exit(2)
+			}
+		}
+		os.Exit(runfile.RunWatch(app, rfcmd, args, watchGlobs, watchIgnore, config.OSStdio()))
+	}
+	// Multiple commands?
+	//
+	if !mainMode {
+		if invocations, ok := parseInvocations(app, rf, cmdName, args); ok {
+			if parallel {
+				os.Exit(runfile.RunParallel(ctx, app, invocations, jobs, config.OSStdio()))
+			}
+			os.Exit(runfile.RunSequential(ctx, app, invocations, config.OSStdio()))
 		}
 	}
 	// Run command, if present, else error
 	//
 	cmdName = strings.ToLower(cmdName) // normalize
-	if cmd, ok := config.CommandMap[cmdName]; ok {
-		cmd.Run()
-	} else {
-		log.Printf("command not found: %s", cmdName)
-		runfile.ListCommands()
-		os.Exit(2)
+	cmd, ok := app.CommandMap[cmdName]
+	if !ok {
+		if cmd = runfile.CommandNotFound(app, rf, cmdName); cmd == nil {
+			os.Exit(2)
+		}
 	}
+	os.Exit(cmd.Run(ctx, args, config.OSStdio()))
 }
 
-func parseArgs() {
+// parseInvocations checks for a list of commands to run.
+// Commands are separated by '+', allowing each to have its own arguments.
+// Without a '+', a list is assumed only if --parallel was given: Otherwise the words are arguments to the first command,
+// even if they name other commands.
+// Returns false if only a single command is being invoked.
+//
+func parseInvocations(app *config.App, rf *runfile.Runfile, cmdName string, args []string) ([]*runfile.Invocation, bool) {
+	words := append([]string{cmdName}, args...)
+	var groups [][]string
+	hasSeparator := false
+	for _, word := range words {
+		if word == invocationSeparator {
+			hasSeparator = true
+			break
+		}
+	}
+	switch {
+	case hasSeparator:
+		group := []string{}
+		for _, word := range words {
+			if word == invocationSeparator {
+				groups = append(groups, group)
+				group = []string{}
+			} else {
+				group = append(group, word)
+			}
+		}
+		groups = append(groups, group)
+	case parallel:
+		for _, word := range words {
+			groups = append(groups, []string{word})
+		}
+	default:
+		return nil, false
+	}
+	var invocations []*runfile.Invocation
+	for _, group := range groups {
+		if len(group) == 0 {
+			log.Printf("expecting command after '%s'", invocationSeparator)
+			showUsage(app) // exits
+		}
+		cmd, ok := app.CommandMap[strings.ToLower(group[0])]
+		if !ok {
+			if cmd = runfile.CommandNotFound(app, rf, group[0]); cmd == nil {
+				os.Exit(2)
+			}
+		}
+		invocations = append(invocations, &runfile.Invocation{Cmd: cmd, Args: group[1:]})
+	}
+	return invocations, true
+}
+
+// parseArgs parses the run tool options, returning the remaining arguments.
+//
+func parseArgs(app *config.App, args []string) []string {
 	var showHelp bool
-	flag.CommandLine.SetOutput(config.ErrOut)
-	flag.CommandLine.Usage = showUsage // Invoked if error parsing args
+	flag.CommandLine.SetOutput(app.ErrOut)
+	flag.CommandLine.Usage = func() { showUsage(app) } // Invoked if error parsing args
 	flag.BoolVar(&showHelp, "help", false, "")
 	flag.BoolVar(&showHelp, "h", false, "")
+	flag.Var(dryRunFlag{app}, "dry-run", "")
+	flag.BoolVar(&app.ShowSecrets, "show-secrets", false, "")
+	flag.BoolVar(&app.UseChecksums, "checksum", false, "")
+	flag.BoolVar(&pickMode, "i", false, "")
+	flag.BoolVar(&pickMode, "interactive", false, "")
+	flag.BoolVar(&app.ForceRun, "force", false, "")
+	flag.DurationVar(&app.KillGrace, "grace", config.DefaultKillGrace, "")
+	flag.Var(timeoutFlag{app}, "timeout", "")
+	flag.BoolVar(&app.AssumeYes, "yes", false, "")
+	flag.BoolVar(&parallel, "parallel", false, "")
+	flag.IntVar(&jobs, "jobs", 0, "")
+	flag.IntVar(&jobs, "j", 0, "")
+	flag.BoolVar(&watchMode, "w", false, "")
+	flag.Var(&watchGlobs, "watch", "")
+	flag.Var(&watchIgnore, "watch-ignore", "")
+	flag.Var(&setVars, "set", "")
+	flag.StringVar(&profileName, "profile", "", "")
 	// No -r/--runfile support in shebang mode
 	//
-	if config.EnableRunfileOverride {
-		flag.StringVar(&inputFile, "runfile", runfileDefault, "")
-		flag.StringVar(&inputFile, "r", runfileDefault, "")
+	if app.EnableRunfileOverride {
+		flag.Var(&inputFiles, "runfile", "")
+		flag.Var(&inputFiles, "r", "")
+		flag.Var(runfileFdFlag{}, "runfile-fd", "")
+		flag.BoolVar(&globalOnly, "global", false, "")
+		flag.BoolVar(&globalOnly, "g", false, "")
 	}
-	flag.Parse()
-	os.Args = flag.Args()
+	_ = flag.CommandLine.Parse(expandJobsArg(args))
+	// Only search for the default runfile
+	//
+	runfileSearch = runfileSearch && len(inputFiles) == 0
+	// -j implies --parallel
+	//
+	parallel = parallel || jobs > 0
+	// --watch implies -w
+	//
+	watchMode = watchMode || len(watchGlobs) > 0
 	// Help?
 	//
 	if showHelp {
-		showUsage()
+		showUsage(app)
+	}
+	return flag.Args()
+}
+
+// valueFlags lists the options that take their value as a separate argument.
+//
+var valueFlags = map[string]bool{"r": true, "runfile": true, "runfile-fd": true, "j": true, "jobs": true, "watch": true, "watch-ignore": true, "grace": true, "timeout": true, "set": true, "profile": true}
+
+// expandJobsArg rewrites '-jN' as '-j=N', which the flag package can parse.
+// Only arguments before the command name are considered.
+//
+func expandJobsArg(args []string) []string {
+	result := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || arg == "--" {
+			return append(result, args[i:]...)
+		}
+		if len(arg) > 2 && strings.HasPrefix(arg, "-j") && arg[2] >= '0' && arg[2] <= '9' {
+			arg = "-j=" + arg[2:]
+		}
+		result = append(result, arg)
+		// Skip option values
+		//
+		if valueFlags[strings.TrimLeft(arg, "-")] && i+1 < len(args) {
+			i++
+			result = append(result, args[i])
+		}
+	}
+	return result
+}
+
+// stringList captures a repeatable string option.
+// Implements flag.Value.
+//
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// runfileFdFlag captures --runfile-fd <N>, adding the file descriptor to the list of runfiles.
+// Implements flag.Value.
+//
+type runfileFdFlag struct{}
+
+func (runfileFdFlag) String() string {
+	return ""
+}
+func (runfileFdFlag) Set(value string) error {
+	if fd, err := strconv.Atoi(value); err != nil || fd < 0 {
+		return fmt.Errorf("expecting a file descriptor number")
+	}
+	inputFiles = append(inputFiles, runfileFdPrefix+value)
+	return nil
+}
+
+// dryRunFlag captures --dry-run[=text|json].
+// Implements flag.Value as a boolean flag, so a value is optional.
+//
+type dryRunFlag struct {
+	app *config.App
+}
+
+func (d dryRunFlag) String() string {
+	if d.app == nil {
+		return ""
+	}
+	return d.app.DryRun
+}
+func (d dryRunFlag) Set(value string) error {
+	switch strings.ToLower(value) {
+	case "true", config.DryRunText:
+		d.app.DryRun = config.DryRunText
+	case config.DryRunJSON:
+		d.app.DryRun = config.DryRunJSON
+	case "false":
+		d.app.DryRun = ""
+	default:
+		return fmt.Errorf("expecting 'text' or 'json'")
+	}
+	return nil
+}
+func (dryRunFlag) IsBoolFlag() bool {
+	return true
+}
+
+// timeoutFlag captures --timeout <duration>, overriding the TIMEOUT of every command.
+// Implements flag.Value.
+//
+type timeoutFlag struct {
+	app *config.App
+}
+
+func (t timeoutFlag) String() string {
+	if t.app == nil || t.app.Timeout == nil {
+		return ""
+	}
+	return t.app.Timeout.String()
+}
+func (t timeoutFlag) Set(value string) error {
+	timeout, err := runfile.ParseTimeout(value)
+	if err != nil {
+		return err
+	}
+	t.app.Timeout = &timeout
+	return nil
+}
+
+// parseRunfiles reads and parses the runfiles, merging them in order.
+// If a runfile is read from stdin, stdin is re-opened from the terminal (if available) for use by commands.
+//
+func parseRunfiles(app *config.App, files []string) *runfile.Runfile {
+	var (
+		asts      []*ast.Ast
+		readStdin bool
+	)
+	for _, file := range files {
+		fileBytes, err := readRunfile(file)
+		if err != nil {
+			log.Printf("Error reading file '%s': %s\n", file, err.Error())
+			showUsage(app) // exits
+		}
+		readStdin = readStdin || file == runfileStdin
+		asts = append(asts, parser.Parse(app, lexer.Lex(app, fileBytes)))
+	}
+	if err := findDuplicateCmd(files, asts); err != nil {
+		log.Println(err)
+		os.Exit(2)
+	}
+	if readStdin {
+		tty := "/dev/tty"
+		if runtime.GOOS == "windows" {
+			tty = "CONIN$"
+		}
+		if in, err := os.Open(tty); err == nil {
+			os.Stdin = in
+		}
+	}
+	return ast.ProcessAST(app, asts...)
+}
+
+// findDuplicateCmd returns an error if more than one of the runfiles defines the same command.
+//
+func findDuplicateCmd(files []string, asts []*ast.Ast) error {
+	defined := map[string]string{} // Command name (lowercased) -> file
+	for i, a := range asts {
+		for _, name := range a.CmdNames() {
+			key := strings.ToLower(name) // normalize
+			if file, ok := defined[key]; ok && file != files[i] {
+				return fmt.Errorf("duplicate command: %s (%s, %s)", name, file, files[i])
+			}
+			defined[key] = files[i]
+		}
+	}
+	return nil
+}
+
+// readRunfile returns the contents of the runfile, which may be stdin ('-') or a file descriptor ('/dev/fd/N').
+//
+func readRunfile(file string) ([]byte, error) {
+	switch {
+	case file == runfileStdin:
+		return ioutil.ReadAll(os.Stdin)
+	case strings.HasPrefix(file, runfileFdPrefix):
+		fd, err := strconv.Atoi(strings.TrimPrefix(file, runfileFdPrefix))
+		if err != nil || fd < 0 {
+			return nil, fmt.Errorf("invalid file descriptor")
+		}
+		f := os.NewFile(uintptr(fd), file)
+		if f == nil {
+			return nil, fmt.Errorf("invalid file descriptor")
+		}
+		defer f.Close()
+		return ioutil.ReadAll(f)
+	}
+	return readFile(file)
+}
+
+// containsString returns true if the list contains the string.
+//
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// globalRunfile returns the path of the user's global runfile, or "" if the config directory cannot be determined.
+// The file is not guaranteed to exist.
+//
+func globalRunfile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
 	}
+	return filepath.Join(dir, "run", runfileDefault)
 }
 
 // Returns contents of file at specified path as a byte array
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/tekwizely/run/internal/ast"
+	"github.com/tekwizely/run/internal/config"
+	"github.com/tekwizely/run/internal/lexer"
+	"github.com/tekwizely/run/internal/parser"
+)
+
+// testApp returns an app with the named (runfile) commands.
+//
+func testApp(names ...string) *config.App {
+	app := config.NewApp("run", ioutil.Discard)
+	for _, name := range names {
+		app.AddCommand(&config.Command{Name: name}, true)
+	}
+	return app
+}
+
+// TestParseInvocations checks when a command line is treated as a list of commands.
+//
+func TestParseInvocations(t *testing.T) {
+	defer func(p bool) { parallel = p }(parallel)
+	tests := []struct {
+		parallel bool
+		cmdName  string
+		args     []string
+		want     [][]string // Command, then its arguments; nil = a single command
+	}{
+		// A trailing argument that names a command is still an argument
+		//
+		{false, "hello", []string{"build"}, nil},
+		{false, "hello", []string{"build", "test"}, nil},
+		{false, "hello", []string{"+", "build", "-v"}, [][]string{{"hello"}, {"build", "-v"}}},
+		{true, "hello", []string{"build"}, [][]string{{"hello"}, {"build"}}},
+	}
+	app := testApp("hello", "build", "test")
+	for _, test := range tests {
+		parallel = test.parallel
+		invocations, ok := parseInvocations(app, nil, test.cmdName, test.args)
+		if !ok {
+			if test.want != nil {
+				t.Errorf("%s %v: got a single command, want %v", test.cmdName, test.args, test.want)
+			}
+			continue
+		}
+		var got [][]string
+		for _, inv := range invocations {
+			got = append(got, append([]string{inv.Cmd.Name}, inv.Args...))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%s %v (parallel=%v): got %v, want %v", test.cmdName, test.args, test.parallel, got, test.want)
+		}
+	}
+}
+
+// TestFindDuplicateCmd checks that a command defined in more than one runfile is reported.
+//
+func TestFindDuplicateCmd(t *testing.T) {
+	app := testApp()
+	parse := func(text string) *ast.Ast { return parser.Parse(app, lexer.Lex(app, []byte(text))) }
+	files := []string{"A", "B"}
+	err := findDuplicateCmd(files, []*ast.Ast{parse("build:\n  echo A\n"), parse("BUILD:\n  echo B\n")})
+	if want := "duplicate command: BUILD (A, B)"; err == nil || err.Error() != want {
+		t.Errorf("got %v, want %s", err, want)
+	}
+	if err = findDuplicateCmd(files, []*ast.Ast{parse("build:\n  echo A\n"), parse("test:\n  echo B\n")}); err != nil {
+		t.Errorf("got %v, want <nil>", err)
+	}
+}
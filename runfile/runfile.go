@@ -0,0 +1,219 @@
+// Package runfile loads Runfiles and runs their commands, for embedding Runfile support within other Go programs.
+//
+//	rf, err := runfile.Load("Runfile")
+//	if err != nil {
+//		return err
+//	}
+//	code, err := rf.Run(ctx, "build", []string{"--verbose"}, &runfile.RunOptions{Stdout: os.Stdout, Stderr: os.Stderr})
+//
+// Variable assignments using shell substitution ($(...)) are evaluated when the Runfile is parsed,
+// from the current working directory.
+//
+package runfile
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/tekwizely/run/internal/ast"
+	"github.com/tekwizely/run/internal/config"
+	"github.com/tekwizely/run/internal/exec"
+	"github.com/tekwizely/run/internal/lexer"
+	"github.com/tekwizely/run/internal/parser"
+	impl "github.com/tekwizely/run/internal/runfile"
+)
+
+// ErrCommandNotFound is returned (wrapped) by Run when the command is not defined.
+//
+var ErrCommandNotFound = errors.New("command not found")
+
+// ErrTimeout is returned (wrapped) by Run when the command runs longer than its TIMEOUT.
+//
+var ErrTimeout = exec.ErrTimeout
+
+// ErrNotConfirmed is returned (wrapped) by Run when the command has a CONFIRM prompt that is not answered 'yes'.
+// The prompt is refused outright if Stdin is not the terminal.
+//
+var ErrNotConfirmed = impl.ErrNotConfirmed
+
+// ConfirmAbortCode is the exit code returned by Run along with ErrNotConfirmed.
+//
+const ConfirmAbortCode = impl.ConfirmAbortCode
+
+// ErrHelp is returned by Run when the arguments request the command's help (-h | --help).
+//
+var ErrHelp = flag.ErrHelp
+
+// UsageExitCode is the exit code returned by Run along with an error for invalid command-line arguments.
+//
+const UsageExitCode = 2
+
+// Runfile is a parsed Runfile.
+// A Runfile is safe for concurrent use: Each Run stores option values in its own copy of the command's variables.
+//
+type Runfile struct {
+	Name string // File name, used in error messages
+	app  *config.App
+	rf   *impl.Runfile
+	cmds []*Command
+}
+
+// Command describes a command defined within a Runfile.
+//
+type Command struct {
+	Name    string
+	Title   string
+	Desc    []string
+	Usages  []string
+	Options []*Option
+	Shell   string
+	cmd     *impl.RunCmd
+}
+
+// Option describes a command-line option of a command.
+//
+type Option struct {
+	Name  string // Variable the value is stored in
+	Short rune   // 0 if none
+	Long  string // "" if none
+	Value string // Value name; "" for flags (booleans)
+	Desc  string
+}
+
+// RunOptions configures how a command is run.
+// Nil streams are connected to the null device.
+// If Stdin is the terminal, the command is given the terminal while it runs.
+//
+type RunOptions struct {
+	Stdin     io.Reader
+	Stdout    io.Writer
+	Stderr    io.Writer
+	Env       []string      // Base environment ("key=value"), to which the command's exported variables are added; nil = os.Environ()
+	Dir       string        // Working directory; "" = current directory
+	KillGrace time.Duration // How long a cancelled command may take to exit before it is killed; 0 = 5s
+	AssumeYes bool          // Skip CONFIRM prompts; otherwise the prompt is shown on Stderr if Stdin is the terminal
+}
+
+// Load reads and parses the Runfile at path.
+//
+func Load(path string) (*Runfile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f, path)
+}
+
+// Parse reads and parses a Runfile.  The name is used in error messages.
+//
+func Parse(r io.Reader, name string) (rf *Runfile, err error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	// The parser panics on error
+	//
+	defer func() {
+		if p := recover(); p != nil {
+			rf, err = nil, fmt.Errorf("%s: %v", name, p)
+		}
+	}()
+	app := config.NewApp(path.Base(name), os.Stderr)
+	b = bytes.TrimPrefix(b, []byte{0xEF, 0xBB, 0xBF})
+	rf = &Runfile{Name: name, app: app, rf: ast.ProcessAST(app, parser.Parse(app, lexer.Lex(app, b)))}
+	seen := make(map[string]bool)
+	for _, cmd := range rf.rf.Cmds {
+		lname := strings.ToLower(cmd.Name) // normalize
+		if seen[lname] {
+			return nil, fmt.Errorf("%s: duplicate command: %s", name, cmd.Name)
+		}
+		seen[lname] = true
+		rf.cmds = append(rf.cmds, newCommand(cmd))
+	}
+	rf.rf.ResolveHooks()
+	return rf, nil
+}
+
+// newCommand describes the runfile command.
+//
+func newCommand(cmd *impl.RunCmd) *Command {
+	c := &Command{
+		Name:   cmd.Name,
+		Title:  cmd.Title(),
+		Desc:   append([]string{}, cmd.Config.Desc...),
+		Usages: append([]string{}, cmd.Config.Usages...),
+		Shell:  cmd.Shell(),
+		cmd:    cmd,
+	}
+	for _, opt := range cmd.Config.Opts {
+		c.Options = append(c.Options, &Option{Name: opt.Name, Short: opt.Short, Long: opt.Long, Value: opt.Value, Desc: opt.Desc})
+	}
+	return c
+}
+
+// Commands returns the commands, in the order they are defined.
+//
+func (r *Runfile) Commands() []*Command {
+	return append([]*Command{}, r.cmds...)
+}
+
+// Lookup finds a command by name (case-insensitive).
+//
+func (r *Runfile) Lookup(name string) (*Command, bool) {
+	cmd := r.rf.FindCmd(name)
+	if cmd == nil {
+		return nil, false
+	}
+	for _, c := range r.cmds {
+		if c.cmd == cmd {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// Run runs the named command with the arguments, which may include the command's options.
+// Returns the command's exit code.  A non-zero exit code is not considered an error.
+// Returns an error if the command is not found (ErrCommandNotFound), the arguments are invalid (ErrHelp if help was requested),
+// or the script could not be executed.
+// Scripts run in their own process group.
+// If ctx is cancelled, the group is sent SIGTERM, followed by SIGKILL if it has not exited within KillGrace.
+// The same applies if the command runs longer than its TIMEOUT, in which case ErrTimeout is returned.
+// Commands with a RETRY policy are re-run on failure, returning the result of the last attempt.
+// The command's BEFORE / AFTER / FINALLY hooks run along with it.
+//
+func (r *Runfile) Run(ctx context.Context, name string, args []string, opts *RunOptions) (int, error) {
+	c, ok := r.Lookup(name)
+	if !ok {
+		return UsageExitCode, fmt.Errorf("%w: %s", ErrCommandNotFound, name)
+	}
+	if opts == nil {
+		opts = &RunOptions{}
+	}
+	cmd := c.cmd.Clone()
+	args, err := impl.ParseCmdOpts(cmd, args)
+	if err == flag.ErrHelp {
+		return UsageExitCode, ErrHelp
+	}
+	if err != nil {
+		return UsageExitCode, fmt.Errorf("%s: %w", c.Name, err)
+	}
+	std := &config.Stdio{In: opts.Stdin, Out: opts.Stdout, Err: opts.Stderr}
+	if !opts.AssumeYes {
+		if err = impl.ConfirmCmd(r.app, cmd, std); err != nil {
+			return ConfirmAbortCode, fmt.Errorf("%s: %w", c.Name, err)
+		}
+	}
+	execOpts := exec.Options{Name: c.Name, Environ: opts.Env, Dir: opts.Dir, Foreground: true, KillGrace: opts.KillGrace, Timeout: cmd.Config.Timeout, Retry: cmd.Config.Retry, ScriptMode: cmd.Config.ScriptMode, Cache: cmd.Config.Cache}
+	return impl.ExecuteCmd(ctx, r.app, cmd, cmd.Shell(), args, impl.CmdEnv(cmd), std, execOpts)
+}
@@ -0,0 +1,103 @@
+package runfile
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// parse parses the Runfile text, failing the test on error.
+//
+func parse(t *testing.T, text string) *Runfile {
+	t.Helper()
+	rf, err := Parse(strings.NewReader(text), "Runfile")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	return rf
+}
+
+// TestRunRetryNilOptions runs a failing command that is retried, with nil options (and so a nil Stderr).
+//
+func TestRunRetryNilOptions(t *testing.T) {
+	rf := parse(t, `
+##
+# RETRY 1 backoff=1ms
+flaky:
+  exit 1
+`)
+	code, err := rf.Run(context.Background(), "flaky", nil, nil)
+	if err != nil || code != 1 {
+		t.Errorf("got (%d, %v), want (1, <nil>)", code, err)
+	}
+}
+
+// TestRunHookNilOptions runs a command with a failing BEFORE hook, with nil options (and so a nil Stderr).
+//
+func TestRunHookNilOptions(t *testing.T) {
+	rf := parse(t, `
+fail:
+  exit 3
+
+##
+# BEFORE fail
+build:
+  echo building
+`)
+	code, err := rf.Run(context.Background(), "build", nil, nil)
+	if err != nil || code != 3 {
+		t.Errorf("got (%d, %v), want (3, <nil>)", code, err)
+	}
+}
+
+// TestRunConcurrent runs a command with different option values concurrently (run with -race).
+//
+func TestRunConcurrent(t *testing.T) {
+	rf := parse(t, `
+##
+# OPTION NAME -n,--name <name> Name to say hello to
+hello:
+  echo "Hello, ${NAME}"
+`)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			var out bytes.Buffer
+			code, err := rf.Run(context.Background(), "hello", []string{"--name", name}, &RunOptions{Stdout: &out})
+			if err != nil || code != 0 {
+				t.Errorf("%s: got (%d, %v), want (0, <nil>)", name, code, err)
+			}
+			if got, want := strings.TrimSpace(out.String()), "Hello, "+name; got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		}(fmt.Sprintf("user%d", i))
+	}
+	wg.Wait()
+}
+
+// TestRunConfirmDevNull runs a command with a CONFIRM prompt, with stdin connected to the null device (not a terminal).
+//
+func TestRunConfirmDevNull(t *testing.T) {
+	rf := parse(t, `
+##
+# CONFIRM "Continue?"
+danger:
+  echo danger
+`)
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer null.Close()
+	code, err := rf.Run(context.Background(), "danger", nil, &RunOptions{Stdin: null})
+	if code != ConfirmAbortCode || !errors.Is(err, ErrNotConfirmed) || !strings.Contains(err.Error(), "stdin is not a terminal") {
+		t.Errorf("got (%d, %v), want (%d, stdin is not a terminal)", code, err, ConfirmAbortCode)
+	}
+}